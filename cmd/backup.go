@@ -4,29 +4,64 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"time"
 
 	"github.com/AdityaNarayan29/masstDB/internal/backup"
+	"github.com/AdityaNarayan29/masstDB/internal/config"
 	"github.com/AdityaNarayan29/masstDB/internal/database"
+	"github.com/AdityaNarayan29/masstDB/internal/failure"
+	"github.com/AdityaNarayan29/masstDB/internal/hooks"
+	"github.com/AdityaNarayan29/masstDB/internal/lock"
 	"github.com/AdityaNarayan29/masstDB/internal/logger"
+	"github.com/AdityaNarayan29/masstDB/internal/metrics"
+	"github.com/AdityaNarayan29/masstDB/internal/notify"
+	"github.com/AdityaNarayan29/masstDB/internal/retry"
+	"github.com/AdityaNarayan29/masstDB/internal/storage"
 	"github.com/spf13/cobra"
 )
 
 var (
-	// Database connection flags
-	dbType   string
-	host     string
-	port     int
-	username string
-	password string
-	dbName   string
-
 	// Backup options
 	outputDir  string
+	uploadTo   string
 	compress   bool
 	backupType string
+
+	// Dump format options, shared with restore
+	dumpFormat   string
+	parallelJobs int
+	dumpContent  string
+
+	// Table filters
+	includeTables    []string
+	excludeTables    []string
+	includeSchemas   []string
+	excludeTableData []string
+
+	// Postgres globals options
+	globals         bool
+	noRolePasswords bool
+
+	// Retry options
+	retries    int
+	retryDelay time.Duration
+
+	// All databases options
+	allDatabases     bool
+	includeDatabases []string
+	excludeDatabases []string
+	parallel         int
+
+	// Job options
+	jobName     string
+	metricsFile string
 )
 
+// stalePartialAge is how long a partial backup file must go unmodified
+// before the startup sweep treats it as abandoned
+const stalePartialAge = time.Hour
+
 var backupCmd = &cobra.Command{
 	Use:   "backup",
 	Short: "Create a database backup",
@@ -46,8 +81,14 @@ Examples:
   # Backup with compression
   dbbackup backup --type postgres --database mydb --compress
 
+  # Run a backup job from the config file and update node_exporter metrics
+  dbbackup backup --job nightly --metrics-file /var/lib/node_exporter/masstdb.prom
+
   # Backup SQLite database
-  dbbackup backup --type sqlite --database /path/to/database.db`,
+  dbbackup backup --type sqlite --database /path/to/database.db
+
+  # Clone a database to another host by piping through ssh
+  dbbackup backup --type postgres --database mydb --output - | ssh other dbbackup restore --type postgres --database mydb --file -`,
 	RunE: runBackup,
 }
 
@@ -55,107 +96,594 @@ func init() {
 	rootCmd.AddCommand(backupCmd)
 
 	// Database connection flags
-	backupCmd.Flags().StringVarP(&dbType, "type", "t", "", "database type (postgres, mysql, mongodb, sqlite)")
-	backupCmd.Flags().StringVarP(&host, "host", "H", "localhost", "database host")
-	backupCmd.Flags().IntVarP(&port, "port", "P", 0, "database port (default depends on db type)")
-	backupCmd.Flags().StringVarP(&username, "user", "u", "", "database username")
-	backupCmd.Flags().StringVarP(&password, "password", "p", "", "database password")
-	backupCmd.Flags().StringVarP(&dbName, "database", "d", "", "database name")
+	addConnectionFlags(backupCmd)
 
 	// Backup options
-	backupCmd.Flags().StringVarP(&outputDir, "output", "o", "./backups", "output directory for backup files")
+	backupCmd.Flags().StringVarP(&outputDir, "output", "o", "./backups", "output directory for backup files (\"-\" for stdout)")
+	backupCmd.Flags().StringVar(&uploadTo, "upload", "", "copy the finished backup to remote storage (s3://, gs:// or sftp:// prefix)")
 	backupCmd.Flags().BoolVarP(&compress, "compress", "c", true, "compress backup file")
 	backupCmd.Flags().StringVarP(&backupType, "backup-type", "b", "full", "backup type (full, incremental, differential)")
 
-	// Mark required flags
-	backupCmd.MarkFlagRequired("type")
-	backupCmd.MarkFlagRequired("database")
+	// Retry options
+	backupCmd.Flags().IntVar(&retries, "retries", retry.DefaultPolicy.MaxAttempts, "attempts for the connection test, dump and upload when they fail transiently (1 disables retries)")
+	backupCmd.Flags().DurationVar(&retryDelay, "retry-delay", retry.DefaultPolicy.InitialDelay, "delay before the first retry, doubled for each further retry")
+
+	// Dump format options
+	backupCmd.Flags().StringVar(&dumpFormat, "format", database.FormatPlain, "dump format: plain, custom or directory (postgres), parallel (mysql), file (sqlite)")
+	backupCmd.Flags().IntVar(&parallelJobs, "jobs", 0, "parallel jobs for postgres directory and mysql parallel format dumps")
+	backupCmd.Flags().StringVar(&dumpContent, "content", database.ContentAll, "what to back up: schema, data or all")
+
+	// Table filters
+	backupCmd.Flags().StringSliceVar(&includeTables, "include-table", nil, "only back up tables matching these glob patterns")
+	backupCmd.Flags().StringSliceVar(&excludeTables, "exclude-table", nil, "skip tables matching these glob patterns")
+	backupCmd.Flags().StringSliceVar(&includeSchemas, "include-schema", nil, "only back up schemas matching these glob patterns (postgres)")
+	backupCmd.Flags().StringSliceVar(&excludeTableData, "exclude-table-data", nil, "back up only the definition of tables matching these glob patterns")
+
+	// Postgres globals options
+	backupCmd.Flags().BoolVar(&globals, "globals", false, "also save the cluster globals (roles, tablespaces) with pg_dumpall --globals-only (postgres)")
+	backupCmd.Flags().BoolVar(&noRolePasswords, "no-role-passwords", false, "leave role passwords out of the saved globals")
+
+	// All databases options
+	backupCmd.Flags().BoolVar(&allDatabases, "all-databases", false, "back up every database on the server, each as its own artifact (postgres, mysql, mongodb)")
+	backupCmd.Flags().StringSliceVar(&includeDatabases, "include-db", nil, "with --all-databases, only back up databases matching these glob patterns")
+	backupCmd.Flags().StringSliceVar(&excludeDatabases, "exclude-db", nil, "with --all-databases, skip databases matching these glob patterns")
+	backupCmd.Flags().IntVar(&parallel, "parallel", defaultParallel, "with --all-databases, number of databases backed up at once")
+
+	// Locking options
+	addLockFlags(backupCmd)
+
+	// Job options
+	backupCmd.Flags().StringVar(&jobName, "job", "", "run a backup job defined in the config file")
+	backupCmd.Flags().StringVar(&metricsFile, "metrics-file", "", "write Prometheus metrics to a node_exporter textfile-collector file")
+}
+
+// backupJob describes a single backup run, built from flags or a configured job
+type backupJob struct {
+	Name       string
+	Database   database.Config
+	OutputDir  string
+	Upload     string // Remote prefix the finished backup is copied to
+	Compress   bool
+	BackupType string
+
+	Globals         bool // Postgres: save the cluster globals with the backup
+	NoRolePasswords bool
+
+	Notify          []notify.Target
+	ShrinkThreshold float64
+	Hooks           config.HooksConfig
+	Retry           map[string]retry.Policy // Retry policy per phase
+
+	// Back up every database on the server matching the patterns
+	AllDatabases     bool
+	IncludeDatabases []string
+	ExcludeDatabases []string
+	Parallel         int
+}
+
+// backupJobFromFlags builds a backup job from command line flags
+func backupJobFromFlags(cmd *cobra.Command) (*backupJob, error) {
+	dbConfig, err := connectionConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+	dbConfig.Format = dumpFormat
+	dbConfig.Jobs = parallelJobs
+	dbConfig.Content = dumpContent
+	dbConfig.Filter = database.TableFilter{
+		IncludeTables:    includeTables,
+		ExcludeTables:    excludeTables,
+		IncludeSchemas:   includeSchemas,
+		ExcludeTableData: excludeTableData,
+	}
+
+	policy := retry.DefaultPolicy
+	policy.MaxAttempts = retries
+	policy.InitialDelay = retryDelay
+
+	return &backupJob{
+		Name:       "cli",
+		Database:   dbConfig,
+		OutputDir:  outputDir,
+		Upload:     uploadTo,
+		Compress:   compress,
+		BackupType: backupType,
+
+		Globals:         globals,
+		NoRolePasswords: noRolePasswords,
+
+		Retry: map[string]retry.Policy{
+			retry.PhaseConnect: policy,
+			retry.PhaseDump:    policy,
+			retry.PhaseUpload:  policy,
+		},
+
+		AllDatabases:     allDatabases,
+		IncludeDatabases: includeDatabases,
+		ExcludeDatabases: excludeDatabases,
+		Parallel:         parallel,
+	}, nil
+}
+
+// backupJobFromConfig builds a backup job from a configured job
+func backupJobFromConfig(job *config.JobConfig) (*backupJob, error) {
+	notifiers, err := notify.FromConfig(job.Notify)
+	if err != nil {
+		return nil, fmt.Errorf("job '%s': %w", job.Name, err)
+	}
+
+	dbConfig, err := jobDatabase(job.Database, job.Tools)
+	if err != nil {
+		return nil, fmt.Errorf("job '%s': %w", job.Name, err)
+	}
+	dbConfig.Format = job.Format
+	dbConfig.Jobs = job.Jobs
+	dbConfig.Content = job.Content
+	dbConfig.Filter = database.TableFilter{
+		IncludeTables:    job.IncludeTables,
+		ExcludeTables:    job.ExcludeTables,
+		IncludeSchemas:   job.IncludeSchemas,
+		ExcludeTableData: job.ExcludeTableData,
+	}
+
+	shrinkThreshold := job.ShrinkThreshold
+	if shrinkThreshold == 0 {
+		shrinkThreshold = notify.DefaultShrinkThreshold
+	}
+
+	parallel := job.Parallel
+	if parallel == 0 {
+		parallel = defaultParallel
+	}
+
+	return &backupJob{
+		Name:       job.Name,
+		Database:   dbConfig,
+		OutputDir:  job.Output,
+		Upload:     job.Upload,
+		Compress:   *job.Compress,
+		BackupType: job.BackupType,
+
+		Globals:         job.Globals,
+		NoRolePasswords: job.NoRolePasswords,
+
+		Notify:          notifiers,
+		ShrinkThreshold: shrinkThreshold,
+		Hooks:           job.Hooks,
+		Retry: map[string]retry.Policy{
+			retry.PhaseConnect: retryPolicy(job.Retry.Connect),
+			retry.PhaseDump:    retryPolicy(job.Retry.Dump),
+			retry.PhaseUpload:  retryPolicy(job.Retry.Upload),
+		},
+
+		AllDatabases:     job.AllDatabases,
+		IncludeDatabases: job.IncludeDatabases,
+		ExcludeDatabases: job.ExcludeDatabases,
+		Parallel:         parallel,
+	}, nil
+}
+
+// retryPolicy applies configured retry settings over the default policy
+func retryPolicy(cfg config.RetryPolicyConfig) retry.Policy {
+	policy := retry.DefaultPolicy
+	if cfg.MaxAttempts != 0 {
+		policy.MaxAttempts = cfg.MaxAttempts
+	}
+	if cfg.InitialDelay != 0 {
+		policy.InitialDelay = cfg.InitialDelay
+	}
+	if cfg.MaxDelay != 0 {
+		policy.MaxDelay = cfg.MaxDelay
+	}
+	if cfg.Multiplier != 0 {
+		policy.Multiplier = cfg.Multiplier
+	}
+	if cfg.Jitter != nil {
+		policy.Jitter = *cfg.Jitter
+	}
+	return policy
 }
 
 func runBackup(cmd *cobra.Command, args []string) error {
-	log := logger.New(verbose)
-	log.Info("Starting backup process...")
+	log, err := newLogger()
+	if err != nil {
+		return err
+	}
+	defer log.Close()
 
-	// Set default ports based on database type
-	if port == 0 {
-		port = database.DefaultPort(dbType)
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	job, err := backupJobFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+	job.Database.Tools = toolPaths(cfg.Tools[job.Database.Type])
+	if jobName != "" {
+		jobConfig, err := cfg.Job(jobName)
+		if err != nil {
+			return err
+		}
+		job, err = backupJobFromConfig(jobConfig)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Keep stdout clean for the backup stream
+	if job.OutputDir == storage.Stdio {
+		log.SetOutput(os.Stderr)
+	}
+	if dbURL != "" {
+		log.Debug("Connection URL: %s", database.RedactURL(dbURL))
+	}
+
+	// Seed metrics from the previous run so counters keep accumulating
+	var registry *metrics.Registry
+	if metricsFile != "" {
+		registry = metrics.NewRegistry()
+		if err := registry.LoadTextfile(metricsFile); err != nil {
+			log.Warn("Failed to load previous metrics: %v", err)
+		}
 	}
 
-	// Create database configuration
-	dbConfig := database.Config{
-		Type:     dbType,
-		Host:     host,
-		Port:     port,
-		Username: username,
-		Password: password,
-		Database: dbName,
+	err = runBackupJob(log, job, registry)
+
+	if registry != nil {
+		if writeErr := registry.WriteTextfile(metricsFile); writeErr != nil {
+			log.Warn("Failed to write metrics file: %v", writeErr)
+		}
+	}
+
+	return err
+}
+
+// runBackupJob runs a backup job, or one backup per database for jobs
+// backing up all databases, and records the runs in registry if not nil
+func runBackupJob(log *logger.Logger, job *backupJob, registry *metrics.Registry) error {
+	if job.AllDatabases {
+		return backupAllDatabases(log, job, registry)
+	}
+
+	startTime := time.Now()
+	result, err := executeBackup(log, job)
+	if registry != nil {
+		registry.RecordBackup(backupRun(job, result, err, startTime))
+	}
+	return err
+}
+
+// executeBackup runs a backup job and sends its notifications
+func executeBackup(log *logger.Logger, job *backupJob) (*backup.Result, error) {
+	log = log.With("job", job.Name, "target", jobTarget(job))
+
+	// The previous backup is needed to detect a shrinking backup
+	var previous *backup.Manifest
+	if len(job.Notify) > 0 && job.OutputDir != storage.Stdio {
+		previous, _ = backup.LatestManifest(job.OutputDir, job.Database.Type, job.Database.Database, job.Database.PartialContent())
+	}
+
+	result, err := performBackup(log, job)
+
+	if len(job.Notify) > 0 {
+		for _, event := range backupEvents(job, result, err, previous) {
+			notify.Send(log, job.Notify, event)
+		}
+	}
+
+	return result, err
+}
+
+// performBackup validates, locks and backs up the job's database, running
+// the job's hooks around the backup while the lock is held
+func performBackup(log *logger.Logger, job *backupJob) (result *backup.Result, err error) {
+	log.Info("Starting backup process...")
+
+	dbConfig := job.Database
+
+	// Set default ports based on database type
+	if dbConfig.Port == 0 {
+		dbConfig.Port = database.DefaultPort(dbConfig.Type)
 	}
 
 	// Validate configuration
 	if err := dbConfig.Validate(); err != nil {
-		return fmt.Errorf("invalid configuration: %w", err)
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if job.Upload != "" {
+		if job.OutputDir == storage.Stdio {
+			return nil, fmt.Errorf("invalid configuration: a backup streamed to stdout can't be uploaded")
+		}
+		if !storage.IsRemote(job.Upload) {
+			return nil, fmt.Errorf("invalid configuration: upload location %q is not an s3://, gs:// or sftp:// URL", job.Upload)
+		}
 	}
 
 	// Create database connector
 	connector, err := database.NewConnector(dbConfig)
 	if err != nil {
-		return fmt.Errorf("failed to create database connector: %w", err)
+		return nil, fmt.Errorf("failed to create database connector: %w", err)
 	}
 
-	// Test connection
-	log.Info("Testing database connection...")
-	if err := connector.TestConnection(); err != nil {
-		return fmt.Errorf("connection test failed: %w", err)
+	// Prevent overlapping backups and restores of the same database
+	targetLock, err := acquireLock(log, dbConfig, "backup")
+	if err != nil {
+		return nil, err
 	}
-	log.Info("Connection successful!")
+	defer func() {
+		if lockErr := releaseLock(log, targetLock); lockErr != nil && err == nil {
+			err = lockErr
+		}
+	}()
+
+	env := hookEnv(job.Name, "backup", dbConfig)
+	if err := hooks.Run(log, hooks.PreBackup, job.Hooks.PreBackup, env); err != nil {
+		runPostHooks(log, hooks.PostBackup, job.Hooks.PostBackup, env, nil, err)
+		return nil, err
+	}
+
+	result, err = createBackup(log, job, dbConfig, connector)
+	if hookErr := runPostHooks(log, hooks.PostBackup, job.Hooks.PostBackup, env, result, err); hookErr != nil && err == nil {
+		return nil, hookErr
+	}
+
+	return result, err
+}
 
-	// Create output directory if it doesn't exist
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return fmt.Errorf("failed to create output directory: %w", err)
+// createBackup tests the connection and writes the backup artifact
+func createBackup(log *logger.Logger, job *backupJob, dbConfig database.Config, connector database.Connector) (*backup.Result, error) {
+	// Test connection, retrying transient failures
+	log.Info("Testing database connection...")
+	attempts, err := retry.Do(log, retry.PhaseConnect, job.Retry[retry.PhaseConnect], connector.TestConnection)
+	if err != nil {
+		return nil, fmt.Errorf("connection test failed: %w", err)
 	}
+	log.Info("Connection successful!")
 
 	// Generate backup filename
-	timestamp := time.Now().Format("20060102_150405")
-	filename := fmt.Sprintf("%s_%s_%s", dbName, backupType, timestamp)
-	outputPath := filepath.Join(outputDir, filename)
+	toStdout := job.OutputDir == storage.Stdio
+	outputPath := storage.Stdio
+	if !toStdout {
+		// Create output directory if it doesn't exist
+		if err := os.MkdirAll(job.OutputDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create output directory: %w", err)
+		}
+
+		// Clean up partial files left behind by crashed backups
+		removed, err := backup.SweepPartials(job.OutputDir, stalePartialAge)
+		if err != nil {
+			log.Warn("Failed to clean up stale partial backups: %v", err)
+		}
+		for _, path := range removed {
+			log.Info("Removed stale partial backup file: %s", path)
+		}
+
+		// SQLite databases are paths; name the backup after the file
+		name := dbConfig.Database
+		if dbConfig.Type == "sqlite" {
+			name = filepath.Base(name)
+		}
+
+		timestamp := time.Now().Format("20060102_150405")
+		filename := fmt.Sprintf("%s_%s_%s", name, job.BackupType, timestamp)
+		if content := dbConfig.PartialContent(); content != "" {
+			filename = fmt.Sprintf("%s_%s_%s_%s", name, job.BackupType, content, timestamp)
+		}
+		outputPath = filepath.Join(job.OutputDir, filename)
+	}
 
 	// Create backup service
 	backupService := backup.NewService(log)
 
+	manifestHost := dbConfig.Host
+	if dbConfig.Type == "sqlite" {
+		manifestHost = ""
+	}
+
 	// Perform backup
 	log.Info("Creating backup...")
 	startTime := time.Now()
 
-	result, err := backupService.Backup(connector, backup.Options{
-		Type:       backupType,
-		OutputPath: outputPath,
-		Compress:   compress,
+	// A dump streamed to stdout can't be retried once bytes went out
+	dumpPolicy := job.Retry[retry.PhaseDump]
+	if toStdout {
+		dumpPolicy.MaxAttempts = 1
+	}
+
+	var result *backup.Result
+	dumpAttempts, err := retry.Do(log, retry.PhaseDump, dumpPolicy, func() error {
+		var err error
+		result, err = backupService.Backup(connector, backup.Options{
+			Type:       job.BackupType,
+			OutputPath: outputPath,
+			Compress:   job.Compress,
+			Database:   dbConfig.Database,
+			Host:       manifestHost,
+			Content:    dbConfig.PartialContent(),
+			Filter:     dbConfig.Filter,
+
+			Globals:         job.Globals,
+			NoRolePasswords: job.NoRolePasswords,
+		})
+		return err
 	})
 	if err != nil {
 		log.Error("Backup failed: %v", err)
-		return fmt.Errorf("backup failed: %w", err)
+		return nil, fmt.Errorf("backup failed: %w", err)
+	}
+
+	// Copy the artifact to remote storage, retrying transient failures
+	attempts = append(attempts, dumpAttempts...)
+	if job.Upload != "" {
+		uploadAttempts, err := uploadArtifacts(log, job, result)
+		attempts = append(attempts, uploadAttempts...)
+		if err != nil {
+			return nil, fmt.Errorf("upload failed: %w", err)
+		}
+	}
+
+	// Record the attempts that led to this backup
+	if result.Manifest != nil {
+		result.Manifest.Attempts = attempts
+		if err := backup.WriteManifest(result.ManifestPath, result.Manifest); err != nil {
+			log.Warn("Failed to record attempts in manifest: %v", err)
+		}
+	}
+
+	// The manifest goes last so that the remote copy is only complete,
+	// and listed by restores, once every file it describes arrived
+	if job.Upload != "" {
+		if _, err := retry.Do(log, retry.PhaseUpload, job.Retry[retry.PhaseUpload], func() error {
+			return uploadFile(log, job, result.ManifestPath)
+		}); err != nil {
+			return nil, fmt.Errorf("upload failed: %w", err)
+		}
 	}
 
 	duration := time.Since(startTime)
 
 	// Log results
-	log.Info("Backup completed successfully!")
-	log.Info("  File: %s", result.FilePath)
-	log.Info("  Size: %s", formatBytes(result.Size))
-	log.Info("  Duration: %s", duration.Round(time.Millisecond))
+	file := result.FilePath
+	if toStdout {
+		file = "stdout"
+	}
+	fields := []any{"duration", duration.Round(time.Millisecond).String(), "size", result.Size,
+		"file", file, "checksum", result.Checksum}
+	if result.Manifest != nil {
+		fields = append(fields, "backup_id", result.Manifest.ID)
+	}
+	log.With(fields...).Info("Backup completed successfully!")
+
+	return result, nil
+}
+
+// uploadArtifacts copies a backup artifact and its cluster globals to the
+// job's upload location
+func uploadArtifacts(log *logger.Logger, job *backupJob, result *backup.Result) ([]retry.Attempt, error) {
+	files := []string{result.FilePath}
+	if result.Manifest != nil && result.Manifest.Globals != nil {
+		files = append(files, filepath.Join(filepath.Dir(result.FilePath), result.Manifest.Globals.File))
+	}
+
+	return retry.Do(log, retry.PhaseUpload, job.Retry[retry.PhaseUpload], func() error {
+		for _, path := range files {
+			if err := uploadFile(log, job, path); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
 
-	return nil
+// uploadFile copies a local backup file under the job's upload location
+func uploadFile(log *logger.Logger, job *backupJob, path string) error {
+	location := storage.Join(job.Upload, filepath.Base(path))
+	log.Info("Uploading %s to %s", filepath.Base(path), location)
+	return storage.Upload(path, location)
 }
 
-func formatBytes(bytes int64) string {
-	const unit = 1024
-	if bytes < unit {
-		return fmt.Sprintf("%d B", bytes)
+// hookEnv describes the job to hook commands
+func hookEnv(jobName, operation string, dbConfig database.Config) hooks.Env {
+	return hooks.Env{
+		"JOB":       jobName,
+		"OPERATION": operation,
+		"TARGET":    lock.Target(dbConfig),
+		"DB_TYPE":   dbConfig.Type,
+		"DB_HOST":   dbConfig.Host,
+		"DB_PORT":   strconv.Itoa(dbConfig.Port),
+		"DB_USER":   dbConfig.Username,
+		"DB_NAME":   dbConfig.Database,
+	}
+}
+
+// runPostHooks runs post hooks with the outcome of the operation added to
+// their environment
+func runPostHooks(log *logger.Logger, phase string, postHooks []config.HookConfig, env hooks.Env, result *backup.Result, err error) error {
+	if len(postHooks) == 0 {
+		return nil
+	}
+
+	postEnv := hooks.Env{}
+	for k, v := range env {
+		postEnv[k] = v
+	}
+
+	postEnv["STATUS"] = "success"
+	if err != nil {
+		postEnv["STATUS"] = "failure"
+		postEnv["ERROR"] = err.Error()
+	}
+	if result != nil {
+		postEnv["ARTIFACT"] = result.FilePath
+		postEnv["CHECKSUM"] = result.Checksum
+		postEnv["SIZE"] = strconv.FormatInt(result.Size, 10)
+		postEnv["MANIFEST"] = result.ManifestPath
+	}
+
+	return hooks.Run(log, phase, postHooks, postEnv)
+}
+
+// backupEvents describes the outcome of a backup for notifications
+func backupEvents(job *backupJob, result *backup.Result, err error, previous *backup.Manifest) []notify.Event {
+	event := notify.Event{
+		Job:    job.Name,
+		Target: jobTarget(job),
+		Time:   time.Now().UTC(),
+	}
+
+	if err != nil {
+		event.Status = notify.StatusFailure
+		event.Message = "Backup failed"
+		event.Error = err.Error()
+		event.ErrorCode = string(failure.Classify(err))
+		return []notify.Event{event}
+	}
+
+	event.Status = notify.StatusSuccess
+	event.Message = "Backup completed successfully"
+	event.Manifest = result.Manifest
+	events := []notify.Event{event}
+
+	if previous != nil && previous.Size > 0 && float64(result.Size) < job.ShrinkThreshold*float64(previous.Size) {
+		shrink := event
+		shrink.Status = notify.StatusShrink
+		shrink.Message = fmt.Sprintf("Backup is %s, less than %.0f%% of the previous backup (%s)",
+			backup.FormatSize(result.Size), job.ShrinkThreshold*100, backup.FormatSize(previous.Size))
+		shrink.PreviousSize = previous.Size
+		events = append(events, shrink)
+	}
+
+	return events
+}
+
+// jobTarget describes the job's database target
+func jobTarget(job *backupJob) string {
+	dbConfig := job.Database
+	if dbConfig.Port == 0 {
+		dbConfig.Port = database.DefaultPort(dbConfig.Type)
+	}
+	return lock.Target(dbConfig)
+}
+
+// backupRun describes the outcome of a backup for metrics
+func backupRun(job *backupJob, result *backup.Result, err error, startTime time.Time) metrics.Run {
+	destination := job.OutputDir
+	if destination == storage.Stdio {
+		destination = "stdout"
+	}
+
+	run := metrics.Run{
+		Job:         job.Name,
+		Target:      jobTarget(job),
+		Destination: destination,
+		Success:     err == nil,
+		Duration:    time.Since(startTime),
+		Finished:    time.Now(),
 	}
-	div, exp := int64(unit), 0
-	for n := bytes / unit; n >= unit; n /= unit {
-		div *= unit
-		exp++
+	if result != nil {
+		run.Size = result.Size
 	}
-	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+	return run
 }
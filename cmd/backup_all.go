@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/AdityaNarayan29/masstDB/internal/backup"
+	"github.com/AdityaNarayan29/masstDB/internal/database"
+	"github.com/AdityaNarayan29/masstDB/internal/logger"
+	"github.com/AdityaNarayan29/masstDB/internal/metrics"
+	"github.com/AdityaNarayan29/masstDB/internal/retry"
+	"github.com/AdityaNarayan29/masstDB/internal/storage"
+)
+
+// defaultParallel is the number of databases backed up at once
+const defaultParallel = 2
+
+// databaseBackup is the outcome of backing up one database of a server
+type databaseBackup struct {
+	name     string
+	result   *backup.Result
+	err      error
+	duration time.Duration
+}
+
+// backupAllDatabases backs up every database on the job's server that
+// matches its patterns, each as its own artifact, with a bounded number
+// of backups running at once. A summary table is printed at the end.
+func backupAllDatabases(log *logger.Logger, job *backupJob, registry *metrics.Registry) error {
+	if job.OutputDir == storage.Stdio {
+		return errors.New("backing up all databases can't stream to stdout")
+	}
+
+	names, err := listDatabases(log, job)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("no databases to back up on %s", jobTarget(job))
+	}
+	log.Info("Backing up %d database(s): %s", len(names), strings.Join(names, ", "))
+
+	workers := job.Parallel
+	if workers < 1 {
+		workers = 1
+	}
+
+	backups := make([]databaseBackup, len(names))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				dbJob := *job
+				dbJob.AllDatabases = false
+				dbJob.Database.Database = names[i]
+
+				startTime := time.Now()
+				result, err := executeBackup(log, &dbJob)
+				if registry != nil {
+					registry.RecordBackup(backupRun(&dbJob, result, err, startTime))
+				}
+				backups[i] = databaseBackup{name: names[i], result: result, err: err, duration: time.Since(startTime)}
+			}
+		}()
+	}
+	for i := range names {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	printBackupSummary(backups)
+
+	var errs []error
+	for _, b := range backups {
+		if b.err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", b.name, b.err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d database backups failed: %w", len(errs), len(backups), errors.Join(errs...))
+	}
+	return nil
+}
+
+// listDatabases lists the databases on the job's server that match its
+// include and exclude patterns, skipping system databases
+func listDatabases(log *logger.Logger, job *backupJob) ([]string, error) {
+	dbConfig, err := database.ServerConfig(job.Database)
+	if err != nil {
+		return nil, err
+	}
+	if dbConfig.Port == 0 {
+		dbConfig.Port = database.DefaultPort(dbConfig.Type)
+	}
+	if err := dbConfig.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	connector, err := database.NewConnector(dbConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create database connector: %w", err)
+	}
+	defer connector.Close()
+
+	lister, ok := connector.(database.Lister)
+	if !ok {
+		return nil, fmt.Errorf("listing databases is not supported for %s", dbConfig.Type)
+	}
+
+	var names []string
+	_, err = retry.Do(log, retry.PhaseConnect, job.Retry[retry.PhaseConnect], func() error {
+		var err error
+		names, err = lister.ListDatabases()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return database.MatchDatabases(dbConfig.Type, names, job.IncludeDatabases, job.ExcludeDatabases)
+}
+
+// printBackupSummary prints the outcome of each database backup
+func printBackupSummary(backups []databaseBackup) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "DATABASE\tSTATUS\tSIZE\tDURATION\tFILE")
+	fmt.Fprintln(w, "--------\t------\t----\t--------\t----")
+
+	failed := 0
+	for _, b := range backups {
+		duration := b.duration.Round(time.Millisecond).String()
+		if b.err != nil {
+			failed++
+			fmt.Fprintf(w, "%s\tfailed\t-\t%s\t%v\n", b.name, duration, b.err)
+			continue
+		}
+		fmt.Fprintf(w, "%s\tok\t%s\t%s\t%s\n", b.name, backup.FormatSize(b.result.Size), duration, b.result.FilePath)
+	}
+
+	w.Flush()
+
+	fmt.Printf("\nTotal: %d database(s), %d succeeded, %d failed\n", len(backups), len(backups)-failed, failed)
+}
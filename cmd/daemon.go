@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/AdityaNarayan29/masstDB/internal/logger"
+	"github.com/AdityaNarayan29/masstDB/internal/metrics"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Daemon flags
+	listenAddr string
+)
+
+var daemonCmd = &cobra.Command{
+	Use:   "daemon",
+	Short: "Run scheduled backup jobs and serve metrics",
+	Long: `Run the backup jobs defined in the config file on their configured
+intervals and expose Prometheus metrics at /metrics.
+
+Each job with an interval runs once at startup and then every interval.
+
+Example config:
+  jobs:
+    - name: nightly
+      interval: 24h
+      database:
+        type: postgres
+        host: db.internal
+        database: app
+      output: /var/backups/db
+
+Examples:
+  masstdb daemon --config /etc/masstdb.yaml
+  masstdb daemon --listen :9187`,
+	RunE: runDaemon,
+}
+
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+
+	daemonCmd.Flags().StringVar(&listenAddr, "listen", ":9187", "address to serve /metrics on (empty disables)")
+	addLockDirFlags(daemonCmd)
+}
+
+func runDaemon(cmd *cobra.Command, args []string) error {
+	log, err := newLogger()
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	var jobs []scheduledJob
+	for _, jobConfig := range cfg.ResolvedJobs() {
+		if jobConfig.Interval <= 0 {
+			log.Warn("Job '%s' has no interval, skipping", jobConfig.Name)
+			continue
+		}
+		job, err := backupJobFromConfig(jobConfig)
+		if err != nil {
+			return err
+		}
+		jobs = append(jobs, scheduledJob{job: job, interval: jobConfig.Interval})
+	}
+	if len(jobs) == 0 {
+		return fmt.Errorf("no scheduled jobs found in config")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	registry := metrics.NewRegistry()
+
+	var server *http.Server
+	if listenAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", registry.Handler())
+		server = &http.Server{Addr: listenAddr, Handler: mux}
+
+		go func() {
+			if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Error("Metrics server failed: %v", err)
+				stop()
+			}
+		}()
+		log.Info("Serving metrics on %s/metrics", listenAddr)
+	}
+
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job scheduledJob) {
+			defer wg.Done()
+			scheduleJob(ctx, log, registry, job)
+		}(job)
+	}
+
+	<-ctx.Done()
+	log.Info("Shutting down, waiting for running jobs...")
+	wg.Wait()
+
+	if server != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}
+
+	return nil
+}
+
+// scheduledJob is a backup job run by the daemon on an interval
+type scheduledJob struct {
+	job      *backupJob
+	interval time.Duration
+}
+
+// scheduleJob runs a job immediately and then on every interval until ctx is done
+func scheduleJob(ctx context.Context, log *logger.Logger, registry *metrics.Registry, scheduled scheduledJob) {
+	job := scheduled.job
+	log.Info("Scheduled job '%s' every %s", job.Name, scheduled.interval)
+
+	ticker := time.NewTicker(scheduled.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := runBackupJob(log, job, registry); err != nil {
+			log.Error("Job '%s' failed: %v", job.Name, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/AdityaNarayan29/masstDB/internal/config"
+	"github.com/AdityaNarayan29/masstDB/internal/database"
+	"github.com/AdityaNarayan29/masstDB/internal/lock"
+	"github.com/AdityaNarayan29/masstDB/internal/storage"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Doctor flags
+	doctorOutputs []string
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check native tools, versions and directories",
+	Long: `Check that the native tools MasstDB shells out to are installed,
+report their versions and flag known incompatibilities.
+
+The doctor checks:
+  - pg_dump, psql, mysqldump, mysql, mongodump, mongorestore, mongosh/mongo
+    and sqlite3 in the configured tool paths or on PATH
+  - pg_dump is at least as new as each configured PostgreSQL server,
+    on the SSH server for targets using remote execution
+  - mongosh is installed rather than only the legacy mongo shell
+  - output, storage and lock directories are writable
+
+Tools of engines that are not used by a configured job or --type, or
+only by targets using remote execution, are reported but not treated as
+problems.
+
+Examples:
+  masstdb doctor
+  masstdb doctor --job nightly
+  masstdb doctor --url postgres://admin@db.internal/mydb`,
+	RunE: runDoctor,
+}
+
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+
+	// Database connection flags
+	addConnectionFlags(doctorCmd)
+
+	doctorCmd.Flags().StringSliceVarP(&doctorOutputs, "output", "o", nil, "additional output directories or storage prefixes to check")
+	doctorCmd.Flags().StringVar(&jobName, "job", "", "only check the given job from the config file")
+	addLockDirFlags(doctorCmd)
+}
+
+// doctorReport collects the outcome of the doctor's checks
+type doctorReport struct {
+	problems int
+}
+
+func (r *doctorReport) ok(format string, args ...any) {
+	fmt.Printf("  [ok]   %s\n", fmt.Sprintf(format, args...))
+}
+
+func (r *doctorReport) warn(format string, args ...any) {
+	fmt.Printf("  [warn] %s\n", fmt.Sprintf(format, args...))
+}
+
+func (r *doctorReport) fail(format string, args ...any) {
+	r.problems++
+	fmt.Printf("  [fail] %s\n", fmt.Sprintf(format, args...))
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	jobs := cfg.ResolvedJobs()
+	if jobName != "" {
+		job, err := cfg.Job(jobName)
+		if err != nil {
+			return err
+		}
+		jobs = []*config.JobConfig{job}
+	}
+
+	// Collect the engines, targets and directories in use
+	engines := map[string]bool{}
+	var targets []database.Config
+	dirs := []string{cfg.Storage.LocalPath}
+
+	flagTarget, err := connectionConfig(cmd)
+	if err != nil {
+		return err
+	}
+	if flagTarget.Type != "" {
+		// Remote execution runs the tools on the SSH server
+		engines[flagTarget.Type] = flagTarget.RemoteExec == nil
+		if flagTarget.Database != "" {
+			flagTarget.Tools = toolPaths(cfg.Tools[flagTarget.Type])
+			targets = append(targets, flagTarget)
+		}
+	}
+	for _, job := range jobs {
+		target, err := jobDatabase(job.Database, job.Tools)
+		if err != nil {
+			return fmt.Errorf("job '%s': %w", job.Name, err)
+		}
+		engines[target.Type] = engines[target.Type] || target.RemoteExec == nil
+		targets = append(targets, target)
+		dirs = append(dirs, job.Output)
+	}
+	dirs = append(dirs, doctorOutputs...)
+	dirs = append(dirs, lockDir)
+	if lockRemote != "" {
+		dirs = append(dirs, lockRemote)
+	}
+
+	report := &doctorReport{}
+	checkTools(report, engines, cfg.Tools)
+	checkTargets(report, targets)
+	checkDirs(report, dirs)
+
+	fmt.Println()
+	if report.problems > 0 {
+		return fmt.Errorf("doctor found %d problem(s)", report.problems)
+	}
+	fmt.Println("All checks passed")
+	return nil
+}
+
+// checkTools reports the native tools found in the configured tool paths
+// or on PATH
+func checkTools(report *doctorReport, engines map[string]bool, paths map[string]config.ToolsConfig) {
+	found := map[string]*database.ToolInfo{}
+
+	fmt.Println("Native tools:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  TOOL\tENGINE\tVERSION\tPATH")
+	fmt.Fprintln(w, "  ----\t------\t-------\t----")
+	for _, tool := range database.Tools {
+		info, err := database.FindTool(tool.Name, toolPaths(paths[tool.Engine]), 0)
+		switch {
+		case info == nil:
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", tool.Name, tool.Engine, "-", "not found")
+		case err != nil:
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", tool.Name, tool.Engine, "unknown", info.Path)
+		default:
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", tool.Name, tool.Engine, info.Version, info.Path)
+		}
+		if info != nil {
+			found[tool.Name] = info
+		}
+	}
+	w.Flush()
+	fmt.Println()
+
+	fmt.Println("Tool checks:")
+	for _, tool := range database.Tools {
+		if tool.Legacy || found[tool.Name] != nil {
+			continue
+		}
+
+		// The connectors fall back to the legacy mongo shell
+		if tool.Name == "mongosh" && found["mongo"] != nil {
+			report.warn("mongosh not found, only the legacy mongo shell (removed in MongoDB 6.0)")
+			continue
+		}
+
+		if engines[tool.Engine] {
+			report.fail("%s not found (required for %s)", tool.Name, tool.Engine)
+		} else {
+			report.warn("%s not found (needed for %s backups)", tool.Name, tool.Engine)
+		}
+	}
+	if report.problems == 0 {
+		report.ok("tools for configured engines are installed")
+	}
+	fmt.Println()
+}
+
+// checkTargets checks tool compatibility with the configured servers
+func checkTargets(report *doctorReport, targets []database.Config) {
+	var checked bool
+	for _, target := range targets {
+		if target.Type != "postgres" {
+			continue
+		}
+		if !checked {
+			fmt.Println("Server checks:")
+			checked = true
+		}
+
+		if target.Port == 0 {
+			target.Port = database.DefaultPort(target.Type)
+		}
+		name := lock.Target(target)
+
+		connector, err := database.NewConnector(target)
+		if err != nil {
+			report.fail("%s: %v", name, err)
+			continue
+		}
+		versionNum, err := connector.(database.ServerVersioner).ServerVersionNum()
+		if err != nil {
+			report.fail("%s: %v", name, err)
+			continue
+		}
+		serverMajor := versionNum / 10000
+
+		// The pg_dump selected for this server's version, or the one on
+		// the SSH server with remote execution
+		var pgDump *database.ToolInfo
+		where := ""
+		if finder, ok := connector.(database.ToolFinder); ok {
+			pgDump, err = finder.FindTool("pg_dump")
+			where = " on " + target.RemoteExec.Host
+		} else {
+			pgDump, err = database.FindTool("pg_dump", target.Tools, serverMajor)
+		}
+		switch {
+		case pgDump == nil && where != "":
+			report.fail("%s: %v", name, err)
+		case pgDump == nil || pgDump.Major() == 0:
+			report.warn("%s: server is PostgreSQL %d, pg_dump version unknown", name, serverMajor)
+		case pgDump.Major() < serverMajor:
+			report.fail("%s: pg_dump %s (%s%s) is older than server PostgreSQL %d", name, pgDump.Version, pgDump.Path, where, serverMajor)
+		default:
+			report.ok("%s: pg_dump %s (%s%s) supports server PostgreSQL %d", name, pgDump.Version, pgDump.Path, where, serverMajor)
+		}
+	}
+	if checked {
+		fmt.Println()
+	}
+}
+
+// checkDirs checks that output, storage and lock locations are writable
+func checkDirs(report *doctorReport, dirs []string) {
+	fmt.Println("Directories:")
+
+	seen := map[string]bool{}
+	for _, dir := range dirs {
+		if dir == "" || dir == storage.Stdio || seen[dir] {
+			continue
+		}
+		seen[dir] = true
+
+		if err := checkWritable(dir); err != nil {
+			report.fail("%s: %v", dir, err)
+		} else {
+			report.ok("%s is writable", dir)
+		}
+	}
+}
+
+// checkWritable creates and removes a probe file in a directory or
+// storage prefix
+func checkWritable(dir string) error {
+	if storage.IsRemote(dir) {
+		probe := storage.Join(dir, ".masstdb-doctor")
+		if err := storage.WriteFile(probe, []byte("ok\n")); err != nil {
+			return err
+		}
+		return storage.Remove(probe)
+	}
+
+	// Directories that don't exist yet are created by the backup, so
+	// probe the closest existing parent instead
+	existing := dir
+	for {
+		if _, err := os.Stat(existing); err == nil {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		existing = parent
+	}
+
+	probe, err := os.CreateTemp(existing, ".masstdb-doctor-*")
+	if err != nil {
+		return fmt.Errorf("not writable: %w", err)
+	}
+	probe.Close()
+	return os.Remove(probe.Name())
+}
@@ -9,6 +9,7 @@ import (
 	"text/tabwriter"
 	"time"
 
+	"github.com/AdityaNarayan29/masstDB/internal/backup"
 	"github.com/spf13/cobra"
 )
 
@@ -88,13 +89,14 @@ func runList(cmd *cobra.Command, args []string) error {
 
 	// Print table
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "NAME\tSIZE\tCREATED")
-	fmt.Fprintln(w, "----\t----\t-------")
+	fmt.Fprintln(w, "ID\tNAME\tSIZE\tCREATED")
+	fmt.Fprintln(w, "--\t----\t----\t-------")
 
 	for _, b := range backups {
-		fmt.Fprintf(w, "%s\t%s\t%s\n",
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+			backupID(b.Name),
 			b.Name,
-			formatBytes(b.Size),
+			backup.FormatSize(b.Size),
 			b.ModTime.Format("2006-01-02 15:04:05"),
 		)
 	}
@@ -108,12 +110,44 @@ func runList(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+var backupExtensions = []string{".sql.gz", ".sql", ".dump.gz", ".dump", ".tar.gz", ".tar", ".bson.gz", ".bson", ".archive.gz", ".archive", ".db.gz", ".db"}
+
 func isBackupFile(name string) bool {
-	extensions := []string{".sql", ".sql.gz", ".dump", ".dump.gz", ".bson", ".bson.gz", ".db", ".db.gz"}
-	for _, ext := range extensions {
+	// Cluster globals belong to the backup they were saved with
+	if strings.Contains(name, backup.GlobalsExtension) {
+		return false
+	}
+	for _, ext := range backupExtensions {
 		if strings.HasSuffix(name, ext) {
 			return true
 		}
 	}
 	return false
 }
+
+// backupID returns the catalog ID of a backup file (its name without extension)
+func backupID(name string) string {
+	for _, ext := range backupExtensions {
+		if strings.HasSuffix(name, ext) {
+			return strings.TrimSuffix(name, ext)
+		}
+	}
+	return name
+}
+
+// findBackup resolves a backup ID to a backup file in the given directory
+func findBackup(dir, id string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && isBackupFile(name) && backupID(name) == id {
+			return filepath.Join(dir, name), nil
+		}
+	}
+
+	return "", fmt.Errorf("no backup with ID '%s' found in '%s'", id, dir)
+}
@@ -0,0 +1,148 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/AdityaNarayan29/masstDB/internal/database"
+	"github.com/AdityaNarayan29/masstDB/internal/lock"
+	"github.com/AdityaNarayan29/masstDB/internal/logger"
+	"github.com/spf13/cobra"
+)
+
+var (
+	// Lock flags shared by backup, restore and locks
+	lockDir     string
+	lockRemote  string
+	lockWait    bool
+	lockNoWait  bool
+	lockTimeout time.Duration
+
+	// Locks command flags
+	breakLock string
+	forceLock bool
+)
+
+var locksCmd = &cobra.Command{
+	Use:   "locks",
+	Short: "Inspect and break target locks",
+	Long: `List the locks that prevent overlapping backups and restores of the
+same database, and break locks left behind by crashed runs.
+
+A lock is held while a backup or restore of a target (engine, host, port
+and database) is running. Locks that are no longer held by a running
+process are reported as stale.
+
+Examples:
+  masstdb locks
+  masstdb locks --lock-remote s3://my-bucket/locks
+  masstdb locks --break postgres_localhost_5432_mydb_1a2b3c4d`,
+	RunE: runLocks,
+}
+
+func init() {
+	rootCmd.AddCommand(locksCmd)
+
+	addLockDirFlags(locksCmd)
+	locksCmd.Flags().StringVar(&breakLock, "break", "", "clear the lock with the given key")
+	locksCmd.Flags().BoolVar(&forceLock, "force", false, "break the lock even if a running process holds it")
+}
+
+// addLockDirFlags registers the flags locating local and remote locks
+func addLockDirFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&lockDir, "lock-dir", lock.DefaultDir(), "directory for local lock files")
+	cmd.Flags().StringVar(&lockRemote, "lock-remote", "", "remote storage prefix for lease locks (s3://, gs://, sftp://)")
+}
+
+// addLockFlags registers the locking flags of backup and restore
+func addLockFlags(cmd *cobra.Command) {
+	addLockDirFlags(cmd)
+	cmd.Flags().BoolVar(&lockWait, "wait", false, "wait for a running backup or restore of the same database to finish")
+	cmd.Flags().BoolVar(&lockNoWait, "no-wait", false, "fail immediately if the database is locked (default)")
+	cmd.Flags().DurationVar(&lockTimeout, "wait-timeout", 0, "maximum time to wait for the lock (0 waits forever)")
+	cmd.MarkFlagsMutuallyExclusive("wait", "no-wait")
+}
+
+// acquireLock takes the target lock for a backup or restore
+func acquireLock(log *logger.Logger, config database.Config, operation string) (*lock.Lock, error) {
+	manager := lock.NewManager(lockDir, lockRemote)
+	manager.Warn = log.Warn
+
+	opts := lock.Options{Wait: lockWait && !lockNoWait, Timeout: lockTimeout}
+	if opts.Wait {
+		log.Debug("Acquiring lock for %s (waiting)...", lock.Target(config))
+	}
+
+	l, err := manager.Acquire(config, operation, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lock: %w", err)
+	}
+
+	log.Debug("Acquired lock %s", l.Info().Key)
+	return l, nil
+}
+
+// releaseLock releases the target lock. Returns an error if its remote
+// lease was lost while the operation ran, as another run may have
+// overlapped it.
+func releaseLock(log *logger.Logger, l *lock.Lock) error {
+	lost := l.Err()
+	if err := l.Release(); err != nil {
+		log.Warn("Failed to release lock: %v", err)
+	}
+	if lost != nil {
+		return fmt.Errorf("the %s lock was lost, another run may have overlapped it: %w", l.Info().Operation, lost)
+	}
+	return nil
+}
+
+func runLocks(cmd *cobra.Command, args []string) error {
+	manager := lock.NewManager(lockDir, lockRemote)
+
+	if breakLock != "" {
+		if err := manager.Break(breakLock, forceLock); err != nil {
+			return fmt.Errorf("failed to break lock: %w", err)
+		}
+		fmt.Printf("Lock '%s' cleared\n", breakLock)
+		return nil
+	}
+
+	locks, err := manager.List()
+	if err != nil {
+		return err
+	}
+
+	if len(locks) == 0 {
+		fmt.Println("No locks found.")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KEY\tTARGET\tOPERATION\tHOLDER\tSINCE\tSTATUS")
+	fmt.Fprintln(w, "---\t------\t---------\t------\t-----\t------")
+
+	for _, l := range locks {
+		status := "stale"
+		if l.Held {
+			status = "held"
+		}
+		if l.Remote {
+			status += " (remote)"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s:%d\t%s\t%s\n",
+			l.Key,
+			l.Target,
+			l.Operation,
+			l.Hostname,
+			l.PID,
+			l.AcquiredAt.Local().Format("2006-01-02 15:04:05"),
+			status,
+		)
+	}
+
+	w.Flush()
+	return nil
+}
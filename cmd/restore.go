@@ -2,11 +2,16 @@ package cmd
 
 import (
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/AdityaNarayan29/masstDB/internal/backup"
+	"github.com/AdityaNarayan29/masstDB/internal/config"
 	"github.com/AdityaNarayan29/masstDB/internal/database"
+	"github.com/AdityaNarayan29/masstDB/internal/hooks"
+	"github.com/AdityaNarayan29/masstDB/internal/lock"
 	"github.com/AdityaNarayan29/masstDB/internal/logger"
+	"github.com/AdityaNarayan29/masstDB/internal/storage"
 	"github.com/spf13/cobra"
 )
 
@@ -14,6 +19,15 @@ var (
 	// Restore specific flags
 	backupFile string
 	tables     []string
+	restoreDir string
+
+	restoreGlobals bool
+	verifyFirst    bool
+
+	// Postgres archive restore options
+	restoreClean bool
+	useList      string
+	listContents bool
 )
 
 var restoreCmd = &cobra.Command{
@@ -25,56 +39,126 @@ The restore command supports:
   - Full database restoration
   - Selective table restoration (if supported by DBMS)
   - Automatic decompression of .gz files
+  - Streaming restore from remote storage (s3://, gs://, sftp://)
+  - Restoring by backup ID as shown by the list command
 
 Examples:
   # Restore full database
   dbbackup restore --file backup.sql.gz --type postgres --database mydb
 
   # Restore specific tables
-  dbbackup restore --file backup.sql.gz --type postgres --database mydb --tables users,orders`,
+  dbbackup restore --file backup.sql.gz --type postgres --database mydb --tables users,orders
+
+  # Restore a backup from S3, verified against its manifest as it streams
+  dbbackup restore --file s3://my-bucket/mydb_full_20240101_020000.sql.gz --type postgres --database mydb
+
+  # Download and verify it before anything is restored
+  dbbackup restore --file s3://my-bucket/mydb_full_20240101_020000.sql.gz --type postgres --database mydb --verify-first
+
+  # Restore onto a fresh cluster, creating the roles saved with --globals first
+  dbbackup restore --file backup.sql.gz --type postgres --database mydb --globals
+
+  # Restore a custom format backup with 8 parallel jobs, replacing existing objects
+  dbbackup restore --file mydb.dump.gz --type postgres --database mydb --jobs 8 --clean
+
+  # List the table of contents, then restore only the entries left in it
+  dbbackup restore --file mydb.dump.gz --type postgres --list > toc.txt
+  dbbackup restore --file mydb.dump.gz --type postgres --database mydb --use-list toc.txt
+
+  # Restore by backup ID
+  dbbackup restore --file mydb_full_20240101_020000 --dir /var/backups/db --type postgres --database mydb`,
 	RunE: runRestore,
 }
 
 func init() {
 	rootCmd.AddCommand(restoreCmd)
 
-	// Database connection flags (reusing from backup)
-	restoreCmd.Flags().StringVarP(&dbType, "type", "t", "", "database type (postgres, mysql, mongodb, sqlite)")
-	restoreCmd.Flags().StringVarP(&host, "host", "H", "localhost", "database host")
-	restoreCmd.Flags().IntVarP(&port, "port", "P", 0, "database port")
-	restoreCmd.Flags().StringVarP(&username, "user", "u", "", "database username")
-	restoreCmd.Flags().StringVarP(&password, "password", "p", "", "database password")
-	restoreCmd.Flags().StringVarP(&dbName, "database", "d", "", "database name")
+	// Database connection flags
+	addConnectionFlags(restoreCmd)
 
 	// Restore specific flags
-	restoreCmd.Flags().StringVarP(&backupFile, "file", "f", "", "backup file to restore from")
+	restoreCmd.Flags().StringVarP(&backupFile, "file", "f", "", "backup file, remote URL (s3://, gs://, sftp://), backup ID or \"-\" for stdin")
+	restoreCmd.Flags().StringVar(&restoreDir, "dir", "./backups", "directory used to resolve backup IDs")
 	restoreCmd.Flags().StringSliceVar(&tables, "tables", nil, "specific tables to restore (comma-separated)")
+	restoreCmd.Flags().IntVar(&parallelJobs, "jobs", 0, "parallel jobs for postgres custom and directory, and mysql parallel format restores")
+	restoreCmd.Flags().StringVar(&dumpContent, "content", database.ContentAll, "what to restore: schema, data or all")
+	restoreCmd.Flags().BoolVar(&restoreClean, "clean", false, "drop objects before recreating them (pg_restore --clean --if-exists)")
+	restoreCmd.Flags().StringVar(&useList, "use-list", "", "restore only the entries of this table of contents file, in its order (pg_restore -L)")
+	restoreCmd.Flags().BoolVar(&listContents, "list", false, "print the table of contents of a custom or directory format backup instead of restoring it")
+	restoreCmd.Flags().BoolVar(&restoreGlobals, "globals", false, "restore the cluster globals saved with the backup first, e.g. on an empty cluster (postgres)")
+	restoreCmd.Flags().BoolVar(&verifyFirst, "verify-first", false, "download remote backups to the temporary directory and verify them before restoring")
+
+	// Locking options
+	addLockFlags(restoreCmd)
+
+	// Job options
+	restoreCmd.Flags().StringVar(&jobName, "job", "", "restore into the database of a job defined in the config file, running its restore hooks")
 
 	// Mark required flags
-	restoreCmd.MarkFlagRequired("type")
-	restoreCmd.MarkFlagRequired("database")
 	restoreCmd.MarkFlagRequired("file")
 }
 
-func runRestore(cmd *cobra.Command, args []string) error {
-	log := logger.New(verbose)
-	log.Info("Starting restore process...")
+func runRestore(cmd *cobra.Command, args []string) (err error) {
+	log, err := newLogger()
+	if err != nil {
+		return err
+	}
+	defer log.Close()
 
-	// Set default ports based on database type
-	if port == 0 {
-		port = database.DefaultPort(dbType)
+	// Keep stdout clean for the listing
+	if listContents {
+		log.SetOutput(os.Stderr)
 	}
 
 	// Create database configuration
-	dbConfig := database.Config{
-		Type:     dbType,
-		Host:     host,
-		Port:     port,
-		Username: username,
-		Password: password,
-		Database: dbName,
+	dbConfig, err := connectionConfig(cmd)
+	if err != nil {
+		return err
 	}
 
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	dbConfig.Tools = toolPaths(cfg.Tools[dbConfig.Type])
+	if dbURL != "" {
+		log.Debug("Connection URL: %s", database.RedactURL(dbURL))
+	}
+
+	name := "cli"
+	var jobHooks config.HooksConfig
+	if jobName != "" {
+		jobConfig, err := cfg.Job(jobName)
+		if err != nil {
+			return err
+		}
+		job, err := backupJobFromConfig(jobConfig)
+		if err != nil {
+			return err
+		}
+		name, dbConfig, jobHooks = job.Name, job.Database, job.Hooks
+	}
+
+	// Set default ports based on database type
+	if dbConfig.Port == 0 {
+		dbConfig.Port = database.DefaultPort(dbConfig.Type)
+	}
+
+	if cmd.Flags().Changed("jobs") {
+		dbConfig.Jobs = parallelJobs
+	}
+	dbConfig.Clean = restoreClean
+	dbConfig.Content = dumpContent
+	dbConfig.Tables = tables
+	dbConfig.UseList = useList
+
+	if listContents {
+		return listBackupContents(log, dbConfig)
+	}
+
+	log = log.With("job", name, "target", lock.Target(dbConfig))
+	log.Info("Starting restore process...")
+
 	// Validate configuration
 	if err := dbConfig.Validate(); err != nil {
 		return fmt.Errorf("invalid configuration: %w", err)
@@ -86,8 +170,64 @@ func runRestore(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to create database connector: %w", err)
 	}
 
+	// Prevent overlapping backups and restores of the same database
+	targetLock, err := acquireLock(log, dbConfig, "restore")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if lockErr := releaseLock(log, targetLock); lockErr != nil && err == nil {
+			err = lockErr
+		}
+	}()
+
+	env := hookEnv(name, "restore", dbConfig)
+	env["ARTIFACT"] = backupFile
+	if err := hooks.Run(log, hooks.PreRestore, jobHooks.PreRestore, env); err != nil {
+		runPostHooks(log, hooks.PostRestore, jobHooks.PostRestore, env, nil, err)
+		return err
+	}
+
+	err = performRestore(log, dbConfig, connector)
+	if hookErr := runPostHooks(log, hooks.PostRestore, jobHooks.PostRestore, env, nil, err); hookErr != nil && err == nil {
+		return hookErr
+	}
+
+	return err
+}
+
+// listBackupContents prints the table of contents of the backup to stdout
+func listBackupContents(log *logger.Logger, dbConfig database.Config) error {
+	connector, err := database.NewConnector(dbConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create database connector: %w", err)
+	}
+	defer connector.Close()
+
+	location, err := resolveBackupFile()
+	if err != nil {
+		return err
+	}
+
+	return backup.NewService(log).ListContents(connector, location, os.Stdout)
+}
+
+// resolveBackupFile resolves --file, which may be a backup ID in the
+// backup directory
+func resolveBackupFile() (string, error) {
+	location := backupFile
+	if location != storage.Stdio && !storage.IsRemote(location) {
+		if _, err := os.Stat(location); os.IsNotExist(err) {
+			return findBackup(restoreDir, backupFile)
+		}
+	}
+	return location, nil
+}
+
+// performRestore tests the connection and restores the backup
+func performRestore(log *logger.Logger, dbConfig database.Config, connector database.Connector) error {
 	// Test connection (skip for SQLite as file may not exist yet)
-	if dbType != "sqlite" {
+	if dbConfig.Type != "sqlite" {
 		log.Info("Testing database connection...")
 		if err := connector.TestConnection(); err != nil {
 			return fmt.Errorf("connection test failed: %w", err)
@@ -97,16 +237,29 @@ func runRestore(cmd *cobra.Command, args []string) error {
 		log.Info("SQLite restore - will create database file if needed")
 	}
 
+	// Resolve backup IDs to files in the backup directory
+	location, err := resolveBackupFile()
+	if err != nil {
+		return err
+	}
+
 	// Create backup service
 	backupService := backup.NewService(log)
 
 	// Perform restore
-	log.Info("Restoring from: %s", backupFile)
+	if location == storage.Stdio {
+		log.Info("Restoring from: stdin")
+	} else {
+		log.Info("Restoring from: %s", location)
+	}
 	startTime := time.Now()
 
 	err = backupService.Restore(connector, backup.RestoreOptions{
-		FilePath: backupFile,
+		FilePath: location,
 		Tables:   tables,
+		Globals:  restoreGlobals,
+
+		VerifyFirst: verifyFirst,
 	})
 	if err != nil {
 		log.Error("Restore failed: %v", err)
@@ -115,8 +268,7 @@ func runRestore(cmd *cobra.Command, args []string) error {
 
 	duration := time.Since(startTime)
 
-	log.Info("Restore completed successfully!")
-	log.Info("  Duration: %s", duration.Round(time.Millisecond))
+	log.With("duration", duration.Round(time.Millisecond).String()).Info("Restore completed successfully!")
 
 	return nil
 }
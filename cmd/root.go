@@ -1,9 +1,18 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"net"
 	"os"
+	"strconv"
+	"strings"
 
+	"github.com/AdityaNarayan29/masstDB/internal/config"
+	"github.com/AdityaNarayan29/masstDB/internal/database"
+	"github.com/AdityaNarayan29/masstDB/internal/failure"
+	"github.com/AdityaNarayan29/masstDB/internal/logger"
+	"github.com/AdityaNarayan29/masstDB/internal/tunnel"
 	"github.com/spf13/cobra"
 )
 
@@ -11,6 +20,35 @@ var (
 	// Used for flags
 	cfgFile string
 	verbose bool
+
+	// Database connection flags shared by the commands
+	dbURL    string
+	dbType   string
+	host     string
+	port     int
+	username string
+	password string
+	dbName   string
+
+	// TLS flags
+	tlsMode       string
+	tlsCA         string
+	tlsCert       string
+	tlsKey        string
+	tlsServerName string
+
+	// SSH tunnel flags
+	sshTunnel     string
+	remoteExec    string
+	sshKey        string
+	sshKnownHosts string
+
+	// Logging flags
+	logLevel      string
+	logFormat     string
+	logFile       string
+	logMaxSize    int64
+	logMaxBackups int
 )
 
 // rootCmd represents the base command when called without any subcommands
@@ -36,14 +74,29 @@ Example usage:
   masstdb backup --type postgres --host localhost --database mydb
   masstdb restore --file backup_20240101.sql.gz --type postgres
   masstdb list --storage local`,
+	SilenceErrors: true,
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		// Flags parsed fine; don't print usage for runtime failures
+		cmd.SilenceUsage = true
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
+// Failures exit with a code specific to their class (see failure.Code).
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		code := failure.Classify(err)
+		if logFormat == logger.FormatJSON {
+			json.NewEncoder(os.Stderr).Encode(map[string]interface{}{
+				"error":     err.Error(),
+				"code":      code,
+				"exit_code": code.ExitCode(),
+			})
+		} else {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		os.Exit(code.ExitCode())
 	}
 }
 
@@ -51,4 +104,216 @@ func init() {
 	// Global flags
 	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.masstdb.yaml)")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
+	rootCmd.PersistentFlags().MarkDeprecated("verbose", "use --log-level debug instead")
+
+	// Logging flags
+	rootCmd.PersistentFlags().StringVar(&logLevel, "log-level", "info", "log level (debug, info, warn, error)")
+	rootCmd.PersistentFlags().StringVar(&logFormat, "log-format", "text", "log format (text, json)")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "also write logs to this file")
+	rootCmd.PersistentFlags().Int64Var(&logMaxSize, "log-max-size", 100, "rotate the log file when it exceeds this size in MB (0 disables)")
+	rootCmd.PersistentFlags().IntVar(&logMaxBackups, "log-max-backups", 5, "number of rotated log files to keep")
+}
+
+// newLogger creates a logger from the logging flags
+func newLogger() (*logger.Logger, error) {
+	level, err := logger.ParseLevel(logLevel)
+	if err != nil {
+		return nil, err
+	}
+	if verbose {
+		level = logger.LevelDebug
+	}
+
+	return logger.NewWithOptions(logger.Options{
+		Level:      level,
+		Format:     logFormat,
+		File:       logFile,
+		MaxSize:    logMaxSize * 1024 * 1024,
+		MaxBackups: logMaxBackups,
+	})
+}
+
+// loadConfig loads the config file given by --config, or the default one
+func loadConfig() (*config.Config, error) {
+	if cfgFile != "" {
+		return config.Load(cfgFile)
+	}
+	return config.LoadDefault()
+}
+
+// toolPaths converts configured tool locations for the connectors
+func toolPaths(tools config.ToolsConfig) database.ToolPaths {
+	return database.ToolPaths{Dir: tools.Path, Versions: tools.Versions}
+}
+
+// addConnectionFlags registers the database connection flags
+func addConnectionFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&dbURL, "url", "", "connection URI (postgres://, mysql://, mongodb://, mongodb+srv://, sqlite:///path); other connection flags override its parts")
+	cmd.Flags().StringVarP(&dbType, "type", "t", "", "database type (postgres, mysql, mongodb, sqlite)")
+	cmd.Flags().StringVarP(&host, "host", "H", "localhost", "database host")
+	cmd.Flags().IntVarP(&port, "port", "P", 0, "database port (default depends on db type)")
+	cmd.Flags().StringVarP(&username, "user", "u", "", "database username")
+	cmd.Flags().StringVarP(&password, "password", "p", "", "database password")
+	cmd.Flags().StringVarP(&dbName, "database", "d", "", "database name")
+
+	cmd.Flags().StringVar(&tlsMode, "tls-mode", "", "TLS mode (disable, prefer, require, verify-ca, verify-full)")
+	cmd.Flags().StringVar(&tlsCA, "tls-ca", "", "CA certificate file to verify the server with")
+	cmd.Flags().StringVar(&tlsCert, "tls-cert", "", "client certificate file")
+	cmd.Flags().StringVar(&tlsKey, "tls-key", "", "client key file")
+	cmd.Flags().StringVar(&tlsServerName, "tls-server-name", "", "host name to verify instead of --host (postgres)")
+
+	cmd.Flags().StringVar(&sshTunnel, "ssh-tunnel", "", "reach the database through an SSH bastion ([user@]host[:port])")
+	cmd.Flags().StringVar(&remoteExec, "remote-exec", "", "run the native tools on this SSH server, e.g. the database host ([user@]host[:port])")
+	cmd.Flags().StringVar(&sshKey, "ssh-key", "", "private key for --ssh-tunnel and --remote-exec (default: ssh-agent)")
+	cmd.Flags().StringVar(&sshKnownHosts, "ssh-known-hosts", "", "known_hosts file for --ssh-tunnel and --remote-exec (default ~/.ssh/known_hosts)")
+}
+
+// sshFlagConfig parses an SSH destination flag ([user@]host[:port]) into
+// a connection using the SSH key flags. Returns nil if the flag is unset.
+func sshFlagConfig(destination string) (*tunnel.Config, error) {
+	if destination == "" {
+		return nil, nil
+	}
+
+	config := &tunnel.Config{KeyFile: sshKey, KnownHosts: sshKnownHosts}
+	address := destination
+	if user, rest, ok := strings.Cut(address, "@"); ok {
+		config.User = user
+		address = rest
+	}
+	config.Host = address
+	if h, p, err := net.SplitHostPort(address); err == nil {
+		config.Port, err = strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SSH port: %q", p)
+		}
+		config.Host = h
+	}
+	return config, nil
+}
+
+// jobSSH converts a configured SSH connection for the connectors
+func jobSSH(t *config.SSHConfig) *tunnel.Config {
+	if t == nil {
+		return nil
+	}
+	return &tunnel.Config{
+		Host:       t.Host,
+		Port:       t.Port,
+		User:       t.User,
+		KeyFile:    t.KeyFile,
+		KnownHosts: t.KnownHosts,
+	}
+}
+
+// tlsConfig returns the TLS settings given by the TLS flags
+func tlsConfig() database.TLSConfig {
+	return database.TLSConfig{
+		Mode:       tlsMode,
+		CAFile:     tlsCA,
+		CertFile:   tlsCert,
+		KeyFile:    tlsKey,
+		ServerName: tlsServerName,
+	}
+}
+
+// connectionConfig builds the database configuration from the connection
+// flags. With --url, flags that were set explicitly override its parts.
+func connectionConfig(cmd *cobra.Command) (database.Config, error) {
+	tunnelConfig, err := sshFlagConfig(sshTunnel)
+	if err != nil {
+		return database.Config{}, err
+	}
+	remoteConfig, err := sshFlagConfig(remoteExec)
+	if err != nil {
+		return database.Config{}, err
+	}
+
+	if dbURL == "" {
+		return database.Config{
+			Type:       dbType,
+			Host:       host,
+			Port:       port,
+			Username:   username,
+			Password:   password,
+			Database:   dbName,
+			TLS:        tlsConfig(),
+			SSHTunnel:  tunnelConfig,
+			RemoteExec: remoteConfig,
+		}, nil
+	}
+
+	dbConfig, err := database.ParseURL(dbURL)
+	if err != nil {
+		return database.Config{}, err
+	}
+
+	flags := cmd.Flags()
+	if flags.Changed("type") {
+		dbConfig.Type = dbType
+	}
+	if flags.Changed("host") {
+		dbConfig.Host = host
+	}
+	if flags.Changed("port") {
+		dbConfig.Port = port
+	}
+	if flags.Changed("user") {
+		dbConfig.Username = username
+	}
+	if flags.Changed("password") {
+		dbConfig.Password = password
+	}
+	if flags.Changed("database") {
+		dbConfig.Database = dbName
+	}
+	dbConfig.TLS = tlsConfig()
+	dbConfig.SSHTunnel = tunnelConfig
+	dbConfig.RemoteExec = remoteConfig
+
+	return dbConfig, nil
+}
+
+// jobDatabase builds the database configuration of a configured job.
+// Fields set next to a url override its parts.
+func jobDatabase(db config.DatabaseConfig, tools config.ToolsConfig) (database.Config, error) {
+	dbConfig := database.Config{}
+	if db.URL != "" {
+		var err error
+		dbConfig, err = database.ParseURL(db.URL)
+		if err != nil {
+			return database.Config{}, err
+		}
+	}
+
+	if db.Type != "" {
+		dbConfig.Type = db.Type
+	}
+	if db.Host != "" {
+		dbConfig.Host = db.Host
+	}
+	if db.Port != 0 {
+		dbConfig.Port = db.Port
+	}
+	if db.Username != "" {
+		dbConfig.Username = db.Username
+	}
+	if db.Password != "" {
+		dbConfig.Password = db.Password
+	}
+	if db.Database != "" {
+		dbConfig.Database = db.Database
+	}
+	dbConfig.TLS = database.TLSConfig{
+		Mode:       db.TLS.Mode,
+		CAFile:     db.TLS.CAFile,
+		CertFile:   db.TLS.CertFile,
+		KeyFile:    db.TLS.KeyFile,
+		ServerName: db.TLS.ServerName,
+	}
+	dbConfig.SSHTunnel = jobSSH(db.SSHTunnel)
+	dbConfig.RemoteExec = jobSSH(db.RemoteExec)
+	dbConfig.Tools = toolPaths(tools)
+
+	return dbConfig, nil
 }
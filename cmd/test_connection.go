@@ -4,7 +4,6 @@ import (
 	"fmt"
 
 	"github.com/AdityaNarayan29/masstDB/internal/database"
-	"github.com/AdityaNarayan29/masstDB/internal/logger"
 	"github.com/spf13/cobra"
 )
 
@@ -24,34 +23,34 @@ func init() {
 	rootCmd.AddCommand(testCmd)
 
 	// Database connection flags
-	testCmd.Flags().StringVarP(&dbType, "type", "t", "", "database type (postgres, mysql, mongodb, sqlite)")
-	testCmd.Flags().StringVarP(&host, "host", "H", "localhost", "database host")
-	testCmd.Flags().IntVarP(&port, "port", "P", 0, "database port")
-	testCmd.Flags().StringVarP(&username, "user", "u", "", "database username")
-	testCmd.Flags().StringVarP(&password, "password", "p", "", "database password")
-	testCmd.Flags().StringVarP(&dbName, "database", "d", "", "database name")
-
-	// Mark required flags
-	testCmd.MarkFlagRequired("type")
-	testCmd.MarkFlagRequired("database")
+	addConnectionFlags(testCmd)
 }
 
 func runTest(cmd *cobra.Command, args []string) error {
-	log := logger.New(verbose)
+	log, err := newLogger()
+	if err != nil {
+		return err
+	}
+	defer log.Close()
+
+	// Create database configuration
+	dbConfig, err := connectionConfig(cmd)
+	if err != nil {
+		return err
+	}
 
 	// Set default ports based on database type
-	if port == 0 {
-		port = database.DefaultPort(dbType)
+	if dbConfig.Port == 0 {
+		dbConfig.Port = database.DefaultPort(dbConfig.Type)
 	}
 
-	// Create database configuration
-	dbConfig := database.Config{
-		Type:     dbType,
-		Host:     host,
-		Port:     port,
-		Username: username,
-		Password: password,
-		Database: dbName,
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	dbConfig.Tools = toolPaths(cfg.Tools[dbConfig.Type])
+	if dbURL != "" {
+		log.Debug("Connection URL: %s", database.RedactURL(dbURL))
 	}
 
 	// Validate configuration
@@ -1,33 +1,65 @@
 package backup
 
 import (
+	"bufio"
 	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/AdityaNarayan29/masstDB/internal/database"
 	"github.com/AdityaNarayan29/masstDB/internal/logger"
+	"github.com/AdityaNarayan29/masstDB/internal/storage"
 )
 
+// ErrVerificationFailed is returned when an artifact doesn't match the
+// checksum recorded in its manifest
+var ErrVerificationFailed = errors.New("backup verification failed")
+
 // Options contains backup configuration options
 type Options struct {
 	Type       string // full, incremental, differential
-	OutputPath string
+	OutputPath string // "-" writes the backup to stdout
 	Compress   bool
+
+	// Postgres: also save the cluster globals (roles, tablespaces),
+	// optionally without role passwords
+	Globals         bool
+	NoRolePasswords bool
+
+	// Recorded in the manifest
+	Database string
+	Host     string
+	Content  string               // schema or data for partial backups, empty for everything
+	Filter   database.TableFilter // Tables selected for the backup
 }
 
 // RestoreOptions contains restore configuration options
 type RestoreOptions struct {
-	FilePath string
+	FilePath string   // Local path, remote URL (s3://, gs://, sftp://) or "-" for stdin
 	Tables   []string // For selective restore
+	Globals  bool     // Restore the cluster globals saved with the backup first
+
+	// Download remote artifacts to verify them before anything is restored,
+	// instead of verifying them as they stream into the restore
+	VerifyFirst bool
 }
 
 // Result contains information about a completed backup
 type Result struct {
-	FilePath string
-	Size     int64
+	FilePath     string
+	Size         int64
+	Checksum     string
+	ManifestPath string    // Empty when streaming to stdout
+	Manifest     *Manifest // Nil when streaming to stdout
 }
 
 // Service handles backup and restore operations
@@ -40,39 +72,176 @@ func NewService(log *logger.Logger) *Service {
 	return &Service{log: log}
 }
 
-// Backup performs a database backup
+// Backup performs a database backup.
+// The artifact is written under a ".partial" name and only renamed into
+// place once the payload, checksum and manifest are safely on disk, so an
+// interrupted backup never looks like a valid one.
 func (s *Service) Backup(connector database.Connector, opts Options) (*Result, error) {
+	// Archives of compressed members aren't compressed again
+	if c, ok := connector.(database.MemberCompressor); ok && c.CompressesMembers() {
+		opts.Compress = false
+	}
+
+	if opts.OutputPath == storage.Stdio {
+		return s.backupToStdout(connector, opts)
+	}
+
 	// Determine output filename
 	outputPath := opts.OutputPath
-	extension := s.getExtension(connector.Type())
+	extension := s.getExtension(connector)
 	outputPath += extension
 
 	if opts.Compress {
 		outputPath += ".gz"
 	}
+	partialPath := outputPath + PartialSuffix
 
 	// Create output file
-	file, err := os.Create(outputPath)
+	file, err := os.Create(partialPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create output file: %w", err)
 	}
-	defer file.Close()
 
-	var writer io.Writer = file
+	committed := false
+	var globalsPath string
+	defer func() {
+		if !committed {
+			// Clean up failed backup file
+			file.Close()
+			os.Remove(partialPath)
+			if globalsPath != "" {
+				os.Remove(globalsPath)
+			}
+		}
+	}()
+
+	// Perform backup
+	s.log.Debug("Writing backup to: %s", partialPath)
+	diag := s.attachDiagnostics(connector)
+	startTime := time.Now()
+	stats, err := s.writeBackup(connector, file, opts.Compress, s.estimateSize(connector, opts))
+	if err != nil {
+		return nil, err
+	}
+
+	// Flush the payload to stable storage before publishing it
+	if err := file.Sync(); err != nil {
+		return nil, fmt.Errorf("failed to sync backup file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("failed to close backup file: %w", err)
+	}
+
+	var globals *GlobalsArtifact
+	if opts.Globals {
+		globalsPath, globals, err = s.writeGlobals(connector, opts)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	manifest := &Manifest{
+		ID:           backupID(outputPath),
+		File:         filepath.Base(outputPath),
+		DatabaseType: connector.Type(),
+		Database:     opts.Database,
+		Host:         opts.Host,
+		BackupType:   opts.Type,
+		Compressed:   opts.Compress,
+		Size:         stats.size,
+		RawSize:      stats.rawSize,
+		Checksum:     stats.checksum,
+		CreatedAt:    startTime.UTC(),
+		Duration:     time.Since(startTime).Round(time.Millisecond).String(),
+		Diagnostics:  diag.Lines(),
+		Globals:      globals,
+		Content:      opts.Content,
+	}
+	if !opts.Filter.IsEmpty() {
+		manifest.Filter = &opts.Filter
+	}
+
+	manifestPath := ManifestPath(outputPath)
+	if err := WriteManifest(manifestPath, manifest); err != nil {
+		return nil, err
+	}
+
+	// Publish the artifact
+	if err := os.Rename(partialPath, outputPath); err != nil {
+		os.Remove(manifestPath)
+		return nil, fmt.Errorf("failed to finalize backup file: %w", err)
+	}
+	committed = true
+
+	if err := storage.SyncDir(filepath.Dir(outputPath)); err != nil {
+		return nil, err
+	}
+
+	return &Result{
+		FilePath:     outputPath,
+		Size:         stats.size,
+		Checksum:     stats.checksum,
+		ManifestPath: manifestPath,
+		Manifest:     manifest,
+	}, nil
+}
+
+// backupToStdout streams a backup to stdout for piping into another process
+func (s *Service) backupToStdout(connector database.Connector, opts Options) (*Result, error) {
+	s.log.Debug("Writing backup to stdout")
+	s.attachDiagnostics(connector)
+	if opts.Globals {
+		return nil, errors.New("cluster globals can't be streamed to stdout")
+	}
+	stats, err := s.writeBackup(connector, os.Stdout, opts.Compress, s.estimateSize(connector, opts))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{
+		FilePath: storage.Stdio,
+		Size:     stats.size,
+		Checksum: stats.checksum,
+	}, nil
+}
+
+// writeStats describes the payload written by writeBackup
+type writeStats struct {
+	size     int64  // bytes written to the destination
+	rawSize  int64  // bytes produced by the connector before compression
+	checksum string // sha256 of the bytes written to the destination
+}
+
+// writeBackup runs the connector backup into w, optionally compressing it,
+// while counting bytes, reporting progress and computing the artifact
+// checksum. expected is the estimated uncompressed size (0 if unknown).
+func (s *Service) writeBackup(connector database.Connector, w io.Writer, compress bool, expected int64) (*writeStats, error) {
+	if compressor, ok := connector.(database.CompressedBackuper); ok && compress {
+		hash := sha256.New()
+		counter := &countingWriter{w: io.MultiWriter(w, hash)}
+		return s.writeCompressedBackup(compressor, counter, hash, expected)
+	}
+	return s.writeStream("Backup", connector.Backup, w, compress, expected)
+}
+
+// writeStream runs dump into w like writeBackup, labelling its progress
+func (s *Service) writeStream(label string, dump func(io.Writer) error, w io.Writer, compress bool, expected int64) (*writeStats, error) {
+	hash := sha256.New()
+	counter := &countingWriter{w: io.MultiWriter(w, hash)}
+	var writer io.Writer = counter
 
 	// Add compression if requested
 	var gzWriter *gzip.Writer
-	if opts.Compress {
-		gzWriter = gzip.NewWriter(file)
-		defer gzWriter.Close()
+	if compress {
+		gzWriter = gzip.NewWriter(counter)
 		writer = gzWriter
 	}
 
-	// Perform backup
-	s.log.Debug("Writing backup to: %s", outputPath)
-	if err := connector.Backup(writer); err != nil {
-		// Clean up failed backup file
-		os.Remove(outputPath)
+	progress := newProgress(s.log, label, expected)
+	raw := &countingWriter{w: progress.Writer(writer)}
+	err := dump(raw)
+	progress.Finish()
+	if err != nil {
 		return nil, err
 	}
 
@@ -83,51 +252,449 @@ func (s *Service) Backup(connector database.Connector, opts Options) (*Result, e
 		}
 	}
 
-	// Get file info for size
-	info, err := os.Stat(outputPath)
+	return &writeStats{
+		size:     counter.n,
+		rawSize:  raw.n,
+		checksum: "sha256:" + hex.EncodeToString(hash.Sum(nil)),
+	}, nil
+}
+
+// writeGlobals saves the cluster globals next to the backup artifact.
+// Returns the path of the globals file and its manifest entry.
+func (s *Service) writeGlobals(connector database.Connector, opts Options) (string, *GlobalsArtifact, error) {
+	dumper, ok := connector.(database.GlobalsDumper)
+	if !ok {
+		return "", nil, fmt.Errorf("cluster globals are not supported for %s", connector.Type())
+	}
+
+	path := opts.OutputPath + GlobalsExtension
+	if opts.Compress {
+		path += ".gz"
+	}
+	partialPath := path + PartialSuffix
+
+	file, err := os.Create(partialPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get file info: %w", err)
+		return "", nil, fmt.Errorf("failed to create globals file: %w", err)
 	}
+	defer os.Remove(partialPath)
+	defer file.Close()
 
-	return &Result{
-		FilePath: outputPath,
-		Size:     info.Size(),
+	s.log.Debug("Writing cluster globals to: %s", partialPath)
+	stats, err := s.writeStream("Globals", func(w io.Writer) error {
+		return dumper.DumpGlobals(w, opts.NoRolePasswords)
+	}, file, opts.Compress, 0)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to dump cluster globals: %w", err)
+	}
+
+	if err := file.Sync(); err != nil {
+		return "", nil, fmt.Errorf("failed to sync globals file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return "", nil, fmt.Errorf("failed to close globals file: %w", err)
+	}
+	if err := os.Rename(partialPath, path); err != nil {
+		return "", nil, fmt.Errorf("failed to finalize globals file: %w", err)
+	}
+
+	return path, &GlobalsArtifact{
+		File:            filepath.Base(path),
+		Size:            stats.size,
+		Checksum:        stats.checksum,
+		NoRolePasswords: opts.NoRolePasswords,
+	}, nil
+}
+
+// writeCompressedBackup writes a backup the connector compressed itself.
+// The stream is decompressed alongside to count its raw size for progress
+// and the manifest, which also checks that it is valid gzip.
+func (s *Service) writeCompressedBackup(compressor database.CompressedBackuper, counter *countingWriter, sum hash.Hash, expected int64) (*writeStats, error) {
+	progress := newProgress(s.log, "Backup", expected)
+	raw := &countingWriter{w: progress.Writer(io.Discard)}
+
+	pr, pw := io.Pipe()
+	inflated := make(chan error, 1)
+	go func() {
+		gzReader, err := gzip.NewReader(pr)
+		if err == nil {
+			_, err = io.Copy(raw, gzReader)
+		}
+		// Keep consuming so the backup isn't blocked
+		io.Copy(io.Discard, pr)
+		inflated <- err
+	}()
+
+	err := compressor.BackupCompressed(io.MultiWriter(counter, pw))
+	pw.Close()
+	inflateErr := <-inflated
+	progress.Finish()
+	if err != nil {
+		return nil, err
+	}
+	if inflateErr != nil {
+		return nil, fmt.Errorf("invalid compressed backup: %w", inflateErr)
+	}
+
+	return &writeStats{
+		size:     counter.n,
+		rawSize:  raw.n,
+		checksum: "sha256:" + hex.EncodeToString(sum.Sum(nil)),
 	}, nil
 }
 
-// Restore restores a database from backup
+// Restore restores a database from backup. Artifacts with a manifest are
+// verified against its checksum: local files before anything is restored,
+// remote ones as they stream into the connector, unless VerifyFirst is
+// set. Others are streamed straight into the connector.
 func (s *Service) Restore(connector database.Connector, opts RestoreOptions) error {
-	// Open backup file
-	file, err := os.Open(opts.FilePath)
+	manifest := s.readManifest(opts.FilePath)
+	s.attachDiagnostics(connector)
+
+	if manifest != nil && manifest.Filter != nil {
+		s.log.Warn("Backup is partial, tables were filtered: %s", manifest.Filter)
+	}
+
+	if opts.Globals {
+		if err := s.restoreGlobals(connector, opts, manifest); err != nil {
+			return err
+		}
+	}
+
+	var expected string
+	if manifest != nil {
+		expected = manifest.Checksum
+		if receiver, ok := connector.(database.BackupContentReceiver); ok {
+			receiver.SetBackupContent(manifest.Content)
+		}
+	}
+
+	s.log.Debug("Restoring from: %s", opts.FilePath)
+	return s.restoreStream("Restore", opts.FilePath, expected, opts.VerifyFirst, connector.Restore)
+}
+
+// ListContents writes the table of contents of the backup at location
+func (s *Service) ListContents(connector database.Connector, location string, w io.Writer) error {
+	lister, ok := connector.(database.ContentLister)
+	if !ok {
+		return fmt.Errorf("%s backups have no table of contents", connector.Type())
+	}
+
+	var expected string
+	if manifest := s.readManifest(location); manifest != nil {
+		expected = manifest.Checksum
+	}
+
+	s.attachDiagnostics(connector)
+	return s.restoreStream("List", location, expected, false, func(r io.Reader) error {
+		return lister.ListContents(r, w)
+	})
+}
+
+// restoreGlobals restores the cluster globals recorded in the manifest
+// of the backup being restored
+func (s *Service) restoreGlobals(connector database.Connector, opts RestoreOptions, manifest *Manifest) error {
+	location := opts.FilePath
+	dumper, ok := connector.(database.GlobalsDumper)
+	if !ok {
+		return fmt.Errorf("cluster globals are not supported for %s", connector.Type())
+	}
+	if manifest == nil || manifest.Globals == nil {
+		return fmt.Errorf("backup %s has no cluster globals", location)
+	}
+
+	globalsLocation := siblingPath(location, manifest.Globals.File)
+	s.log.Info("Restoring cluster globals from: %s", globalsLocation)
+	if err := s.restoreStream("Globals", globalsLocation, manifest.Globals.Checksum, opts.VerifyFirst, dumper.RestoreGlobals); err != nil {
+		return fmt.Errorf("failed to restore cluster globals: %w", err)
+	}
+	return nil
+}
+
+// restoreStream opens the artifact at location, decompresses it if needed
+// and passes it to restore, reporting progress. If expected is set, the
+// artifact is verified against it: local files and, with verifyFirst,
+// downloaded remote ones before restore is called, other remote ones as
+// restore reads them, which fails once the whole stream has been read.
+func (s *Service) restoreStream(label, location, expected string, verifyFirst bool, restore func(io.Reader) error) error {
+	// Open backup file (local or remote)
+	var file io.ReadCloser
+	var verifier *verifyingReader
+	var err error
+	switch {
+	case expected == "":
+		file, err = storage.Open(location)
+	case storage.IsRemote(location) && !verifyFirst:
+		file, err = storage.Open(location)
+		verifier = &verifyingReader{r: file, hash: sha256.New(), expected: expected}
+	default:
+		file, err = s.openVerified(location, expected)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to open backup file: %w", err)
+		return err
 	}
 	defer file.Close()
 
-	var reader io.Reader = file
+	// Local and spooled files have a known size, which gives the progress an ETA
+	var total int64
+	if f, ok := file.(interface{ Stat() (os.FileInfo, error) }); ok {
+		if info, err := f.Stat(); err == nil && info.Mode().IsRegular() {
+			total = info.Size()
+		}
+	}
 
-	// Check if file is compressed
-	if strings.HasSuffix(opts.FilePath, ".gz") {
-		gzReader, err := gzip.NewReader(file)
+	var source io.Reader = file
+	if verifier != nil {
+		source = verifier
+	}
+
+	progress := newProgress(s.log, label, total)
+	defer progress.Finish()
+
+	buffered := bufio.NewReader(progress.Reader(source))
+	var reader io.Reader = buffered
+
+	// Check if file is compressed (by extension, or by magic bytes for
+	// streams such as stdin that have no name)
+	if strings.HasSuffix(location, ".gz") || isGzip(buffered) {
+		gzReader, err := gzip.NewReader(buffered)
 		if err != nil {
-			return fmt.Errorf("failed to create gzip reader: %w", err)
+			return verifier.failure(fmt.Errorf("failed to create gzip reader: %w", err))
 		}
 		defer gzReader.Close()
 		reader = gzReader
 	}
 
-	// Perform restore
-	s.log.Debug("Restoring from: %s", opts.FilePath)
-	if err := connector.Restore(reader); err != nil {
+	if err := restore(reader); err != nil {
+		return verifier.failure(err)
+	}
+	return verifier.finish()
+}
+
+// verifyingReader hashes an artifact as it is read and checks it against
+// the expected checksum at EOF, returning ErrVerificationFailed instead of
+// EOF on a mismatch, so the restore reading it fails
+type verifyingReader struct {
+	r        io.Reader
+	hash     hash.Hash
+	expected string
+	done     bool
+	err      error
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	if v.done {
+		if v.err != nil {
+			return 0, v.err
+		}
+		return 0, io.EOF
+	}
+
+	n, err := v.r.Read(p)
+	v.hash.Write(p[:n])
+	if err == io.EOF {
+		v.done = true
+		if actual := "sha256:" + hex.EncodeToString(v.hash.Sum(nil)); actual != v.expected {
+			v.err = fmt.Errorf("%w: checksum %s does not match manifest (%s)", ErrVerificationFailed, actual, v.expected)
+			return n, v.err
+		}
+	}
+	return n, err
+}
+
+// finish reads the rest of the artifact, e.g. past the end of the gzip
+// stream, and returns the verification result. Restores that read the
+// whole artifact have already seen a mismatch as a read error.
+func (v *verifyingReader) finish() error {
+	if v == nil {
+		return nil
+	}
+	if _, err := io.Copy(io.Discard, v); err != nil && !errors.Is(err, ErrVerificationFailed) {
+		return fmt.Errorf("failed to read backup file: %w", err)
+	}
+	return v.err
+}
+
+// failure returns the error of a failed restore, reported as a
+// verification failure if the artifact was read to the end and didn't
+// match. The rest of the artifact isn't read for nothing.
+func (v *verifyingReader) failure(err error) error {
+	if v == nil || v.err == nil || errors.Is(err, ErrVerificationFailed) {
 		return err
 	}
+	return fmt.Errorf("%w (%v)", v.err, err)
+}
 
-	return nil
+// openVerified opens the artifact at location after checking it against
+// the expected checksum, so a damaged artifact is never applied. Local
+// files are hashed in place; remote artifacts are downloaded to a
+// temporary file while hashing and restored from it.
+func (s *Service) openVerified(location, expected string) (io.ReadCloser, error) {
+	var file interface {
+		io.ReadSeekCloser
+		Stat() (os.FileInfo, error)
+	}
+	if storage.IsRemote(location) {
+		spool, err := s.spool(location)
+		if err != nil {
+			return nil, err
+		}
+		file = spool
+	} else {
+		f, err := os.Open(location)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open backup file: %w", err)
+		}
+		file = f
+	}
+
+	var total int64
+	if info, err := file.Stat(); err == nil {
+		total = info.Size()
+	}
+
+	progress := newProgress(s.log, "Verify", total)
+	hash := sha256.New()
+	_, err := io.Copy(hash, progress.Reader(file))
+	progress.Finish()
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to read backup file: %w", err)
+	}
+
+	actual := "sha256:" + hex.EncodeToString(hash.Sum(nil))
+	if actual != expected {
+		file.Close()
+		return nil, fmt.Errorf("%w: checksum %s does not match manifest (%s)", ErrVerificationFailed, actual, expected)
+	}
+	s.log.Debug("Checksum verified: %s", actual)
+	return file, nil
 }
 
-// getExtension returns the appropriate file extension for a database type
-func (s *Service) getExtension(dbType string) string {
-	switch dbType {
+// spoolFile is a downloaded artifact, removed when it is closed
+type spoolFile struct {
+	*os.File
+}
+
+func (f spoolFile) Close() error {
+	err := f.File.Close()
+	os.Remove(f.Name())
+	return err
+}
+
+// spool downloads a remote artifact to a temporary file
+func (s *Service) spool(location string) (spoolFile, error) {
+	src, err := storage.Open(location)
+	if err != nil {
+		return spoolFile{}, err
+	}
+
+	temp, err := os.CreateTemp("", "masstdb-restore-*")
+	if err != nil {
+		src.Close()
+		return spoolFile{}, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	file := spoolFile{temp}
+
+	s.log.Debug("Downloading %s to verify it before restoring", location)
+	_, err = io.Copy(file, src)
+	if closeErr := src.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return spoolFile{}, fmt.Errorf("failed to download backup file: %w", err)
+	}
+	return file, nil
+}
+
+// siblingPath returns the location of a file in the same directory (or
+// remote prefix) as location
+func siblingPath(location, name string) string {
+	if storage.IsRemote(location) {
+		return location[:strings.LastIndex(location, "/")+1] + name
+	}
+	return filepath.Join(filepath.Dir(location), name)
+}
+
+// readManifest returns the artifact's manifest, or nil if there is none
+func (s *Service) readManifest(location string) *Manifest {
+	if location == storage.Stdio {
+		return nil
+	}
+
+	data, err := storage.ReadFile(ManifestPath(location))
+	if err != nil {
+		return nil
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		s.log.Warn("Ignoring unreadable manifest: %v", err)
+		return nil
+	}
+	return &m
+}
+
+// attachDiagnostics streams the connector's native tool stderr into the
+// log as it arrives, at a level matching each line
+func (s *Service) attachDiagnostics(connector database.Connector) *database.Diagnostics {
+	diag := database.NewDiagnostics(database.DiagnosticLines, func(tool string, severity database.Severity, line string) {
+		log := s.log.With("tool", tool)
+		switch severity {
+		case database.SeverityError:
+			log.Error("%s", line)
+		case database.SeverityWarn:
+			log.Warn("%s", line)
+		default:
+			log.Debug("%s", line)
+		}
+	})
+
+	if receiver, ok := connector.(database.DiagnosticsReceiver); ok {
+		receiver.SetDiagnostics(diag)
+	}
+	return diag
+}
+
+// estimateSize estimates the uncompressed size of a backup, preferring the
+// previous backup's manifest and falling back to the database's own size
+func (s *Service) estimateSize(connector database.Connector, opts Options) int64 {
+	if opts.OutputPath != storage.Stdio {
+		previous, err := LatestManifest(filepath.Dir(opts.OutputPath), connector.Type(), opts.Database, opts.Content)
+		if err == nil && previous != nil && previous.RawSize > 0 {
+			s.log.Debug("Estimated size from previous backup: %d bytes", previous.RawSize)
+			return previous.RawSize
+		}
+	}
+
+	if sizer, ok := connector.(database.Sizer); ok {
+		size, err := sizer.Size()
+		if err != nil {
+			s.log.Debug("Could not determine database size: %v", err)
+			return 0
+		}
+		s.log.Debug("Estimated size from database: %d bytes", size)
+		return size
+	}
+
+	return 0
+}
+
+// getExtension returns the appropriate file extension for a connector's
+// artifacts
+func (s *Service) getExtension(connector database.Connector) string {
+	if e, ok := connector.(database.Extensioner); ok && e.Extension() != "" {
+		return e.Extension()
+	}
+
+	switch connector.Type() {
 	case "postgres", "mysql", "sqlite":
 		return ".sql"
 	case "mongodb":
@@ -136,3 +703,21 @@ func (s *Service) getExtension(dbType string) string {
 		return ".backup"
 	}
 }
+
+// isGzip reports whether the stream starts with the gzip magic bytes
+func isGzip(r *bufio.Reader) bool {
+	magic, err := r.Peek(2)
+	return err == nil && magic[0] == 0x1f && magic[1] == 0x8b
+}
+
+// countingWriter counts the bytes written through it
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,222 @@
+package backup
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AdityaNarayan29/masstDB/internal/database"
+	"github.com/AdityaNarayan29/masstDB/internal/retry"
+	"github.com/AdityaNarayan29/masstDB/internal/storage"
+)
+
+// PartialSuffix marks artifacts that are still being written
+const PartialSuffix = ".partial"
+
+// ManifestSuffix is appended to an artifact path to name its manifest
+const ManifestSuffix = ".manifest.json"
+
+// GlobalsExtension names the cluster globals file saved with a backup
+const GlobalsExtension = ".globals.sql"
+
+// Manifest describes a completed backup artifact
+type Manifest struct {
+	ID           string    `json:"id"`
+	File         string    `json:"file"`
+	DatabaseType string    `json:"database_type"`
+	Database     string    `json:"database"`
+	Host         string    `json:"host,omitempty"`
+	BackupType   string    `json:"backup_type"`
+	Compressed   bool      `json:"compressed"`
+	Size         int64     `json:"size"`
+	RawSize      int64     `json:"raw_size"`
+	Checksum     string    `json:"checksum"`
+	CreatedAt    time.Time `json:"created_at"`
+	Duration     string    `json:"duration"`
+	Diagnostics  []string  `json:"diagnostics,omitempty"` // Last stderr lines of the native tools
+	Content      string    `json:"content,omitempty"`     // schema or data for partial backups
+
+	Attempts []retry.Attempt       `json:"attempts,omitempty"` // Connection test, dump and upload attempts
+	Globals  *GlobalsArtifact      `json:"globals,omitempty"`  // Cluster globals saved with the backup
+	Filter   *database.TableFilter `json:"filter,omitempty"`   // Tables selected for a partial backup
+}
+
+// GlobalsArtifact describes the cluster globals saved alongside a backup
+type GlobalsArtifact struct {
+	File            string `json:"file"`
+	Size            int64  `json:"size"`
+	Checksum        string `json:"checksum"`
+	NoRolePasswords bool   `json:"no_role_passwords,omitempty"`
+}
+
+// ManifestPath returns the manifest path for an artifact
+func ManifestPath(artifactPath string) string {
+	return artifactPath + ManifestSuffix
+}
+
+// ReadManifest loads a manifest from disk
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+
+	return &m, nil
+}
+
+// WriteManifest atomically writes a manifest to disk
+func WriteManifest(path string, m *Manifest) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	return writeFileAtomic(path, append(data, '\n'))
+}
+
+// SweepPartials removes ".partial" files in dir that have not been
+// modified for at least olderThan. They are left behind by backups that
+// crashed or were killed. Manifests and cluster globals files whose
+// artifact doesn't exist are removed too: they are published just before
+// the artifact, so a crash in between leaves them orphaned. Returns the
+// removed paths.
+func SweepPartials(dir string, olderThan time.Duration) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+
+	names := make([]string, len(entries))
+	for i, entry := range entries {
+		names[i] = entry.Name()
+	}
+
+	var removed []string
+	for _, entry := range entries {
+		if entry.IsDir() || !isPartial(dir, entry.Name(), names) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || time.Since(info.ModTime()) < olderThan {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		if err := os.Remove(path); err != nil {
+			return removed, fmt.Errorf("failed to remove stale partial %s: %w", path, err)
+		}
+		removed = append(removed, path)
+	}
+
+	return removed, nil
+}
+
+// isPartial reports whether a file in dir is a partial file, or a manifest
+// or cluster globals file without its artifact. names lists the files in
+// dir.
+func isPartial(dir, name string, names []string) bool {
+	if strings.HasSuffix(name, PartialSuffix) {
+		return true
+	}
+
+	if strings.HasSuffix(name, ManifestSuffix) {
+		_, err := os.Stat(filepath.Join(dir, strings.TrimSuffix(name, ManifestSuffix)))
+		return os.IsNotExist(err)
+	}
+
+	// The globals file is named after the artifact without its extension
+	if base, ok := strings.CutSuffix(strings.TrimSuffix(name, ".gz"), GlobalsExtension); ok {
+		return !slices.ContainsFunc(names, func(other string) bool {
+			return strings.HasPrefix(other, base+".") && other != name &&
+				!strings.HasSuffix(other, ManifestSuffix) && !strings.HasSuffix(other, PartialSuffix)
+		})
+	}
+
+	return false
+}
+
+// writeFileAtomic writes data to a temporary file, syncs it and renames
+// it over path
+func writeFileAtomic(path string, data []byte) error {
+	partialPath := path + PartialSuffix
+
+	file, err := os.Create(partialPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", partialPath, err)
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(partialPath)
+		return fmt.Errorf("failed to write %s: %w", partialPath, err)
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(partialPath)
+		return fmt.Errorf("failed to sync %s: %w", partialPath, err)
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(partialPath)
+		return fmt.Errorf("failed to close %s: %w", partialPath, err)
+	}
+
+	if err := os.Rename(partialPath, path); err != nil {
+		os.Remove(partialPath)
+		return fmt.Errorf("failed to rename %s: %w", partialPath, err)
+	}
+
+	return storage.SyncDir(filepath.Dir(path))
+}
+
+// backupID derives the backup ID from an artifact path (its file name
+// without extensions)
+func backupID(artifactPath string) string {
+	name := filepath.Base(artifactPath)
+	name = strings.TrimSuffix(name, ".gz")
+	return strings.TrimSuffix(name, filepath.Ext(name))
+}
+
+// LatestManifest returns the most recent manifest in dir for the given
+// database and content ("" for full backups), or nil if there is none
+func LatestManifest(dir, dbType, database, content string) (*Manifest, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+ManifestSuffix))
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *Manifest
+	for _, path := range paths {
+		// Skip manifests orphaned by a crash before their artifact was published
+		if _, err := os.Stat(strings.TrimSuffix(path, ManifestSuffix)); err != nil {
+			continue
+		}
+
+		m, err := ReadManifest(path)
+		if err != nil {
+			continue
+		}
+		if m.DatabaseType != dbType || m.Database != database || m.Content != content {
+			continue
+		}
+		if latest == nil || m.CreatedAt.After(latest.CreatedAt) {
+			latest = m
+		}
+	}
+
+	return latest, nil
+}
@@ -0,0 +1,176 @@
+package backup
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/AdityaNarayan29/masstDB/internal/logger"
+)
+
+const (
+	// ttyRefreshInterval is how often the progress line is redrawn on a terminal
+	ttyRefreshInterval = 500 * time.Millisecond
+
+	// logRefreshInterval is how often progress is logged when not on a terminal
+	logRefreshInterval = 30 * time.Second
+)
+
+// progress reports live throughput of a backup or restore. On a terminal
+// it redraws a single status line on stderr; otherwise it falls back to
+// periodic log lines.
+type progress struct {
+	log   *logger.Logger
+	label string
+	total int64 // Expected number of bytes, 0 if unknown
+	out   io.Writer
+	tty   bool
+
+	n     atomic.Int64
+	start time.Time
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+// newProgress starts reporting progress. total may be 0 if unknown.
+func newProgress(log *logger.Logger, label string, total int64) *progress {
+	p := &progress{
+		log:   log,
+		label: label,
+		total: total,
+		out:   os.Stderr,
+		tty:   isTerminal(os.Stderr),
+		start: time.Now(),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go p.run()
+	return p
+}
+
+// Writer wraps w so that writes are counted
+func (p *progress) Writer(w io.Writer) io.Writer {
+	return &progressWriter{w: w, p: p}
+}
+
+// Reader wraps r so that reads are counted
+func (p *progress) Reader(r io.Reader) io.Reader {
+	return &progressReader{r: r, p: p}
+}
+
+// Finish stops reporting and clears the progress line
+func (p *progress) Finish() {
+	close(p.stop)
+	<-p.done
+
+	if p.tty {
+		fmt.Fprintf(p.out, "\r%s\r", strings.Repeat(" ", 79))
+	}
+}
+
+func (p *progress) run() {
+	defer close(p.done)
+
+	interval := logRefreshInterval
+	if p.tty {
+		interval = ttyRefreshInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			if p.tty {
+				fmt.Fprintf(p.out, "\r%-79s", p.status())
+			} else {
+				p.log.Info("%s", p.status())
+			}
+		}
+	}
+}
+
+// status formats bytes, rate, elapsed time and (when the total is known) ETA
+func (p *progress) status() string {
+	n := p.n.Load()
+	elapsed := time.Since(p.start)
+
+	var rate float64
+	if elapsed > 0 {
+		rate = float64(n) / elapsed.Seconds()
+	}
+
+	line := fmt.Sprintf("%s: %s  %s/s  elapsed %s",
+		p.label, FormatSize(n), FormatSize(int64(rate)), formatDuration(elapsed))
+
+	if p.total > 0 && rate > 0 {
+		if n < p.total {
+			eta := time.Duration(float64(p.total-n) / rate * float64(time.Second))
+			line += fmt.Sprintf("  ETA %s (%d%%)", formatDuration(eta), n*100/p.total)
+		} else {
+			line += "  ETA soon"
+		}
+	}
+
+	return line
+}
+
+type progressWriter struct {
+	w io.Writer
+	p *progress
+}
+
+func (pw *progressWriter) Write(b []byte) (int, error) {
+	n, err := pw.w.Write(b)
+	pw.p.n.Add(int64(n))
+	return n, err
+}
+
+type progressReader struct {
+	r io.Reader
+	p *progress
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	pr.p.n.Add(int64(n))
+	return n, err
+}
+
+// isTerminal reports whether f is attached to a terminal
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// FormatSize formats a byte count with binary units, e.g. "1.5 MB"
+func FormatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	h := d / time.Hour
+	d -= h * time.Hour
+	m := d / time.Minute
+	d -= m * time.Minute
+	return fmt.Sprintf("%02d:%02d:%02d", h, m, d/time.Second)
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -13,20 +15,69 @@ type Config struct {
 	DefaultDatabase DatabaseConfig `yaml:"default_database"`
 	Storage         StorageConfig  `yaml:"storage"`
 	Backup          BackupConfig   `yaml:"backup"`
+	Jobs            []JobConfig    `yaml:"jobs"`
+
+	Tools map[string]ToolsConfig `yaml:"tools"` // Native tool locations by engine
+}
+
+// ToolsConfig locates the native tools of an engine
+type ToolsConfig struct {
+	Path     string         `yaml:"path"`     // Directory searched before PATH
+	Versions map[int]string `yaml:"versions"` // Directories by server major version
 }
 
 // DatabaseConfig holds default database settings
 type DatabaseConfig struct {
-	Type     string `yaml:"type"`
-	Host     string `yaml:"host"`
-	Port     int    `yaml:"port"`
-	Username string `yaml:"username"`
-	Password string `yaml:"password"`
+	URL        string     `yaml:"url"` // Connection URI; the fields below override its parts
+	Type       string     `yaml:"type"`
+	Host       string     `yaml:"host"`
+	Port       int        `yaml:"port"`
+	Username   string     `yaml:"username"`
+	Password   string     `yaml:"password"`
+	Database   string     `yaml:"database"`
+	TLS        TLSConfig  `yaml:"tls"`
+	SSHTunnel  *SSHConfig `yaml:"ssh_tunnel"`  // Reach the database through an SSH bastion
+	RemoteExec *SSHConfig `yaml:"remote_exec"` // Run the native tools on this SSH server, e.g. the database host
+}
+
+// SSHConfig holds the settings of an SSH connection
+type SSHConfig struct {
+	Host       string `yaml:"host"`
+	Port       int    `yaml:"port"`        // Default 22
+	User       string `yaml:"user"`        // Default: the current user
+	KeyFile    string `yaml:"key_file"`    // Private key; the ssh-agent is used if empty
+	KnownHosts string `yaml:"known_hosts"` // Default ~/.ssh/known_hosts
+}
+
+// TLSConfig holds the TLS settings of a database connection
+type TLSConfig struct {
+	Mode       string `yaml:"mode"` // disable, prefer, require, verify-ca, verify-full
+	CAFile     string `yaml:"ca_file"`
+	CertFile   string `yaml:"cert_file"`
+	KeyFile    string `yaml:"key_file"`
+	ServerName string `yaml:"server_name"` // Host name to verify instead of the connection host
+}
+
+// engine returns the database type, taken from the url scheme if unset
+func (d DatabaseConfig) engine() string {
+	if d.Type != "" || d.URL == "" {
+		return d.Type
+	}
+
+	scheme, _, _ := strings.Cut(d.URL, "://")
+	switch scheme {
+	case "postgresql":
+		return "postgres"
+	case "mongodb+srv":
+		return "mongodb"
+	}
+	return scheme
 }
 
 // StorageConfig holds storage settings
 type StorageConfig struct {
 	LocalPath string      `yaml:"local_path"`
+	Upload    string      `yaml:"upload"` // Remote prefix (s3://, gs://, sftp://) backups are copied to
 	Cloud     CloudConfig `yaml:"cloud"`
 }
 
@@ -41,8 +92,101 @@ type CloudConfig struct {
 
 // BackupConfig holds backup settings
 type BackupConfig struct {
-	Compress    bool   `yaml:"compress"`
-	DefaultType string `yaml:"default_type"` // full, incremental, differential
+	Compress    bool        `yaml:"compress"`
+	DefaultType string      `yaml:"default_type"` // full, incremental, differential
+	Retry       RetryConfig `yaml:"retry"`
+}
+
+// RetryConfig configures retries of transient failures. The top-level
+// settings apply to every phase and can be overridden per phase.
+type RetryConfig struct {
+	RetryPolicyConfig `yaml:",inline"`
+	Connect           RetryPolicyConfig `yaml:"connect"`
+	Dump              RetryPolicyConfig `yaml:"dump"`
+	Upload            RetryPolicyConfig `yaml:"upload"`
+}
+
+// RetryPolicyConfig holds retry settings; unset fields are inherited
+type RetryPolicyConfig struct {
+	MaxAttempts  int           `yaml:"max_attempts"`
+	InitialDelay time.Duration `yaml:"initial_delay"`
+	MaxDelay     time.Duration `yaml:"max_delay"`
+	Multiplier   float64       `yaml:"multiplier"`
+	Jitter       *float64      `yaml:"jitter"`
+}
+
+// JobConfig describes a named backup job. Unset fields fall back to
+// default_database, storage and backup settings.
+type JobConfig struct {
+	Name       string         `yaml:"name"`
+	Database   DatabaseConfig `yaml:"database"`
+	Output     string         `yaml:"output"`
+	Upload     string         `yaml:"upload"` // Remote prefix the finished backup is copied to
+	Compress   *bool          `yaml:"compress"`
+	BackupType string         `yaml:"backup_type"`
+	Interval   time.Duration  `yaml:"interval"` // How often the daemon runs the job (0 disables scheduling)
+
+	// Dump format (postgres: plain, custom, directory; mysql: plain, parallel; sqlite: plain, file)
+	// and parallel jobs
+	Format string `yaml:"format"`
+	Jobs   int    `yaml:"jobs"`
+
+	Content string `yaml:"content"` // schema, data or all (default)
+
+	// Table filters (glob patterns)
+	IncludeTables    []string `yaml:"include_tables"`
+	ExcludeTables    []string `yaml:"exclude_tables"`
+	IncludeSchemas   []string `yaml:"include_schemas"` // Postgres only
+	ExcludeTableData []string `yaml:"exclude_table_data"`
+
+	// Postgres: save the cluster globals (roles, tablespaces) with each backup
+	Globals         bool `yaml:"globals"`
+	NoRolePasswords bool `yaml:"no_role_passwords"`
+
+	// Back up every database on the server instead of database.database
+	AllDatabases     bool     `yaml:"all_databases"`
+	IncludeDatabases []string `yaml:"include_databases"` // Glob patterns; default all
+	ExcludeDatabases []string `yaml:"exclude_databases"` // Glob patterns
+	Parallel         int      `yaml:"parallel"`          // Databases backed up at once (default 2)
+
+	Notify          []NotifyConfig `yaml:"notify"`
+	ShrinkThreshold float64        `yaml:"shrink_threshold"` // Notify when a backup is smaller than this fraction of the previous one
+
+	Hooks HooksConfig `yaml:"hooks"`
+	Retry RetryConfig `yaml:"retry"` // Overrides backup.retry
+	Tools ToolsConfig `yaml:"tools"` // Overrides the tools of the job's engine
+}
+
+// HooksConfig holds the commands run around backups and restores
+type HooksConfig struct {
+	PreBackup   []HookConfig `yaml:"pre_backup"`
+	PostBackup  []HookConfig `yaml:"post_backup"`
+	PreRestore  []HookConfig `yaml:"pre_restore"`
+	PostRestore []HookConfig `yaml:"post_restore"`
+}
+
+// HookConfig describes a single hook command
+type HookConfig struct {
+	Command     string        `yaml:"command"` // Run through sh -c (cmd /C on Windows)
+	Timeout     time.Duration `yaml:"timeout"`
+	FailOnError *bool         `yaml:"fail_on_error"` // Fail the job if the hook fails (default true)
+}
+
+// NotifyConfig configures a notification channel for a job
+type NotifyConfig struct {
+	Type    string            `yaml:"type"` // webhook, slack, email
+	On      []string          `yaml:"on"`   // success, failure, shrink (default: failure, shrink)
+	URL     string            `yaml:"url"`  // webhook and slack
+	Headers map[string]string `yaml:"headers"`
+	CAFile  string            `yaml:"ca_file"` // webhook and slack: extra CA certificates to verify the server with
+
+	// Email settings
+	SMTPHost string   `yaml:"smtp_host"`
+	SMTPPort int      `yaml:"smtp_port"`
+	Username string   `yaml:"username"`
+	Password string   `yaml:"password"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
 }
 
 // DefaultConfig returns a config with sensible defaults
@@ -99,6 +243,115 @@ func LoadDefault() (*Config, error) {
 	return DefaultConfig(), nil
 }
 
+// Job returns the named job with defaults applied
+func (c *Config) Job(name string) (*JobConfig, error) {
+	for _, job := range c.Jobs {
+		if job.Name == name {
+			return c.resolveJob(job), nil
+		}
+	}
+	return nil, fmt.Errorf("job '%s' not found in config", name)
+}
+
+// ResolvedJobs returns all jobs with defaults applied
+func (c *Config) ResolvedJobs() []*JobConfig {
+	jobs := make([]*JobConfig, 0, len(c.Jobs))
+	for _, job := range c.Jobs {
+		jobs = append(jobs, c.resolveJob(job))
+	}
+	return jobs
+}
+
+// resolveJob fills unset job fields from the global defaults
+func (c *Config) resolveJob(job JobConfig) *JobConfig {
+	// A url carries its own connection settings, so the default fields
+	// only apply to jobs without one
+	db := &job.Database
+	if db.URL == "" {
+		db.URL = c.DefaultDatabase.URL
+	}
+	if db.URL == "" {
+		if db.Type == "" {
+			db.Type = c.DefaultDatabase.Type
+		}
+		if db.Host == "" {
+			db.Host = c.DefaultDatabase.Host
+		}
+		if db.Port == 0 {
+			db.Port = c.DefaultDatabase.Port
+		}
+		if db.Username == "" {
+			db.Username = c.DefaultDatabase.Username
+		}
+		if db.Password == "" {
+			db.Password = c.DefaultDatabase.Password
+		}
+		if db.Database == "" {
+			db.Database = c.DefaultDatabase.Database
+		}
+	}
+	if db.TLS == (TLSConfig{}) {
+		db.TLS = c.DefaultDatabase.TLS
+	}
+	if db.SSHTunnel == nil {
+		db.SSHTunnel = c.DefaultDatabase.SSHTunnel
+	}
+	if db.RemoteExec == nil {
+		db.RemoteExec = c.DefaultDatabase.RemoteExec
+	}
+
+	if job.Output == "" {
+		job.Output = c.Storage.LocalPath
+	}
+	if job.Upload == "" {
+		job.Upload = c.Storage.Upload
+	}
+	if job.Compress == nil {
+		compress := c.Backup.Compress
+		job.Compress = &compress
+	}
+	if job.BackupType == "" {
+		job.BackupType = c.Backup.DefaultType
+	}
+
+	tools := c.Tools[db.engine()]
+	if job.Tools.Path == "" {
+		job.Tools.Path = tools.Path
+	}
+	if job.Tools.Versions == nil {
+		job.Tools.Versions = tools.Versions
+	}
+
+	// Job phase, job, global phase, then global retry settings
+	global, jobRetry := c.Backup.Retry, job.Retry.RetryPolicyConfig
+	job.Retry.Connect = job.Retry.Connect.inherit(jobRetry).inherit(global.Connect).inherit(global.RetryPolicyConfig)
+	job.Retry.Dump = job.Retry.Dump.inherit(jobRetry).inherit(global.Dump).inherit(global.RetryPolicyConfig)
+	job.Retry.Upload = job.Retry.Upload.inherit(jobRetry).inherit(global.Upload).inherit(global.RetryPolicyConfig)
+	job.Retry.RetryPolicyConfig = jobRetry.inherit(global.RetryPolicyConfig)
+
+	return &job
+}
+
+// inherit fills unset retry settings from parent
+func (r RetryPolicyConfig) inherit(parent RetryPolicyConfig) RetryPolicyConfig {
+	if r.MaxAttempts == 0 {
+		r.MaxAttempts = parent.MaxAttempts
+	}
+	if r.InitialDelay == 0 {
+		r.InitialDelay = parent.InitialDelay
+	}
+	if r.MaxDelay == 0 {
+		r.MaxDelay = parent.MaxDelay
+	}
+	if r.Multiplier == 0 {
+		r.Multiplier = parent.Multiplier
+	}
+	if r.Jitter == nil {
+		r.Jitter = parent.Jitter
+	}
+	return r
+}
+
 // Save saves configuration to a YAML file
 func (c *Config) Save(path string) error {
 	data, err := yaml.Marshal(c)
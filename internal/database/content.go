@@ -0,0 +1,56 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Backup contents
+const (
+	ContentAll    = "all"    // Schema and data (default)
+	ContentSchema = "schema" // Definitions only: tables, indexes, views, routines
+	ContentData   = "data"   // Rows only
+)
+
+// validateContent checks the selected backup content
+func (c Config) validateContent() error {
+	switch c.Content {
+	case "", ContentAll, ContentSchema, ContentData:
+		return nil
+	default:
+		return fmt.Errorf("unsupported content: %s (use schema, data or all)", c.Content)
+	}
+}
+
+// PartialContent returns the selected content if only the schema or only
+// the data is selected, or "" for everything
+func (c Config) PartialContent() string {
+	if c.Content == ContentSchema || c.Content == ContentData {
+		return c.Content
+	}
+	return ""
+}
+
+// BackupContentReceiver is implemented by connectors that restore part of
+// a backup, to learn what the backup being restored holds
+type BackupContentReceiver interface {
+	// SetBackupContent records the content from the backup's manifest
+	SetBackupContent(content string)
+}
+
+// restoreContent returns the content to pick out of the backup being
+// restored, or "" to restore all of it. Selecting the content a partial
+// backup holds restores all of it; selecting content it doesn't hold is
+// an error.
+func (c Config) restoreContent() (string, error) {
+	content := c.PartialContent()
+	switch {
+	case content == "" || content == c.BackupContent:
+		return "", nil
+	case c.BackupContent == ContentSchema:
+		return "", errors.New("the backup only holds the schema, no data")
+	case c.BackupContent == ContentData:
+		return "", errors.New("the backup only holds the data, no schema")
+	}
+	return content, nil
+}
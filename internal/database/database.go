@@ -3,16 +3,39 @@ package database
 import (
 	"fmt"
 	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/AdityaNarayan29/masstDB/internal/tunnel"
 )
 
 // Config holds database connection configuration
 type Config struct {
-	Type     string // postgres, mysql, mongodb, sqlite
-	Host     string
-	Port     int
-	Username string
-	Password string
-	Database string
+	Type       string // postgres, mysql, mongodb, sqlite
+	Host       string
+	Port       int
+	Username   string
+	Password   string
+	Database   string
+	Options    map[string]string // Connection options such as sslmode, replicaSet or charset
+	SRV        bool              // MongoDB: resolve hosts through DNS SRV records (mongodb+srv)
+	TLS        TLSConfig
+	SSHTunnel  *tunnel.Config // Reach the database through an SSH bastion
+	RemoteExec *tunnel.Config // Run the native tools on this SSH server instead of locally
+	Tools      ToolPaths      // Where to find the native tools
+	Content    string         // schema, data or all (default)
+	Filter     TableFilter    // Tables to back up
+
+	// Restore: schema or data if the backup only holds that, from its manifest
+	BackupContent string
+
+	// PostgreSQL archive settings
+	Format  string   // Dump format: plain (default), custom, directory or parallel
+	Jobs    int      // Parallel jobs for directory and parallel format dumps and archive restores
+	Clean   bool     // Restore: drop objects before recreating them
+	Tables  []string // Restore: only these tables
+	UseList string   // Restore: only the entries of this table of contents, in its order
 }
 
 // Validate checks if the configuration is valid
@@ -36,6 +59,16 @@ func (c Config) Validate() error {
 		return fmt.Errorf("database name is required")
 	}
 
+	if err := c.validateFormat(); err != nil {
+		return err
+	}
+	if err := c.validateContent(); err != nil {
+		return err
+	}
+	if err := c.validateFilter(); err != nil {
+		return err
+	}
+
 	// SQLite doesn't need host/port/credentials
 	if c.Type == "sqlite" {
 		return nil
@@ -45,6 +78,30 @@ func (c Config) Validate() error {
 		return fmt.Errorf("host is required for %s", c.Type)
 	}
 
+	if err := c.TLS.validate(); err != nil {
+		return err
+	}
+	if c.Type == "mysql" {
+		if err := validateMySQLOptions(c.Options); err != nil {
+			return err
+		}
+		// The mysql client always verifies the certificate against --host
+		if c.TLS.ServerName != "" {
+			return fmt.Errorf("TLS server name is not supported for mysql")
+		}
+		if c.SSHTunnel != nil && c.TLS.Mode == TLSVerifyFull {
+			return fmt.Errorf("verify-full TLS is not supported for mysql through an SSH tunnel, as the certificate would be checked against the tunnel address; use verify-ca")
+		}
+	}
+	if c.Type == "mongodb" {
+		if c.TLS.KeyFile != "" && c.TLS.KeyFile != c.TLS.CertFile {
+			return fmt.Errorf("mongodb expects the TLS client certificate and key in a single PEM file; set only the certificate file")
+		}
+		if c.TLS.ServerName != "" {
+			return fmt.Errorf("TLS server name is not supported for mongodb")
+		}
+	}
+
 	return nil
 }
 
@@ -52,17 +109,31 @@ func (c Config) Validate() error {
 func (c Config) ConnectionString() string {
 	switch c.Type {
 	case "postgres":
-		return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
+		conn := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s",
 			c.Host, c.Port, c.Username, c.Password, c.Database)
+		for _, setting := range [][2]string{
+			{"sslmode", c.TLS.Mode},
+			{"sslrootcert", c.TLS.CAFile},
+			{"sslcert", c.TLS.CertFile},
+			{"sslkey", c.TLS.KeyFile},
+		} {
+			if _, ok := c.Options[setting[0]]; !ok && setting[1] != "" {
+				conn += fmt.Sprintf(" %s=%s", setting[0], setting[1])
+			}
+		}
+		for _, key := range c.optionKeys() {
+			conn += fmt.Sprintf(" %s=%s", key, c.Options[key])
+		}
+		return conn
 	case "mysql":
-		return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s",
+		conn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s",
 			c.Username, c.Password, c.Host, c.Port, c.Database)
-	case "mongodb":
-		if c.Username != "" {
-			return fmt.Sprintf("mongodb://%s:%s@%s:%d/%s",
-				c.Username, c.Password, c.Host, c.Port, c.Database)
+		if len(c.Options) > 0 {
+			conn += "?" + c.query()
 		}
-		return fmt.Sprintf("mongodb://%s:%d/%s", c.Host, c.Port, c.Database)
+		return conn
+	case "mongodb":
+		return c.mongoURI()
 	case "sqlite":
 		return c.Database // SQLite uses file path directly
 	default:
@@ -70,6 +141,21 @@ func (c Config) ConnectionString() string {
 	}
 }
 
+// mongoURI builds a mongodb:// (or mongodb+srv://) URI from the config
+func (c Config) mongoURI() string {
+	u := url.URL{Scheme: "mongodb", Host: c.Host, Path: "/" + c.Database}
+	if c.SRV {
+		u.Scheme = "mongodb+srv"
+	} else if !strings.Contains(c.Host, ",") {
+		u.Host = fmt.Sprintf("%s:%d", c.Host, c.Port)
+	}
+	if c.Username != "" {
+		u.User = url.UserPassword(c.Username, c.Password)
+	}
+	u.RawQuery = c.query()
+	return u.String()
+}
+
 // DefaultPort returns the default port for a database type
 func DefaultPort(dbType string) int {
 	ports := map[string]int{
@@ -102,8 +188,39 @@ type Connector interface {
 	SupportsIncremental() bool
 }
 
+// Sizer is implemented by connectors that can report the size of the
+// database, used to estimate backup progress
+type Sizer interface {
+	// Size returns the approximate size of the database in bytes
+	Size() (int64, error)
+}
+
+// GlobalsDumper is implemented by connectors that dump and restore the
+// cluster-wide objects (roles, tablespaces) a database dump leaves out
+type GlobalsDumper interface {
+	// DumpGlobals writes the globals, without role passwords if
+	// noRolePasswords is set
+	DumpGlobals(w io.Writer, noRolePasswords bool) error
+
+	// RestoreGlobals restores globals written by DumpGlobals
+	RestoreGlobals(r io.Reader) error
+}
+
+// DiagnosticsReceiver is implemented by connectors that report the stderr
+// output of the native tools they run
+type DiagnosticsReceiver interface {
+	SetDiagnostics(d *Diagnostics)
+}
+
 // NewConnector creates a new database connector based on the configuration
 func NewConnector(config Config) (Connector, error) {
+	if config.RemoteExec != nil {
+		return newRemoteConnector(config)
+	}
+	if config.SSHTunnel != nil {
+		return newTunnelConnector(config)
+	}
+
 	switch config.Type {
 	case "postgres":
 		return NewPostgresConnector(config)
@@ -117,3 +234,13 @@ func NewConnector(config Config) (Connector, error) {
 		return nil, fmt.Errorf("unsupported database type: %s", config.Type)
 	}
 }
+
+// parseSize parses a byte count printed by a database shell
+func parseSize(output []byte) (int64, error) {
+	value := strings.TrimSpace(string(output))
+	size, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected size output: %q", value)
+	}
+	return int64(size), nil
+}
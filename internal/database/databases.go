@@ -0,0 +1,86 @@
+package database
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Lister is implemented by connectors that can list the databases on the
+// server
+type Lister interface {
+	ListDatabases() ([]string, error)
+}
+
+// SystemDatabases are skipped when backing up all databases of a server,
+// by database type
+var SystemDatabases = map[string]map[string]bool{
+	"postgres": {"template0": true, "template1": true},
+	"mysql":    {"information_schema": true, "performance_schema": true, "sys": true, "mysql": true},
+	"mongodb":  {"admin": true, "local": true, "config": true},
+}
+
+// maintenanceDatabases are connected to for listing the databases
+var maintenanceDatabases = map[string]string{
+	"postgres": "postgres",
+	"mysql":    "information_schema",
+	"mongodb":  "admin",
+}
+
+// ServerConfig returns the configuration connecting to the server's
+// maintenance database, for listing its databases
+func ServerConfig(config Config) (Config, error) {
+	name, ok := maintenanceDatabases[config.Type]
+	if !ok {
+		return Config{}, fmt.Errorf("listing databases is not supported for %s", config.Type)
+	}
+	config.Database = name
+	return config, nil
+}
+
+// MatchDatabases returns the names matching any include pattern (all if
+// there are none) and no exclude pattern, skipping the system databases of
+// the dbType server.
+// Patterns are globs such as "app_*".
+func MatchDatabases(dbType string, names, include, exclude []string) ([]string, error) {
+	var matched []string
+	for _, name := range names {
+		if SystemDatabases[dbType][name] {
+			continue
+		}
+
+		included := len(include) == 0
+		for _, pattern := range include {
+			ok, err := path.Match(pattern, name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid database pattern %q: %w", pattern, err)
+			}
+			included = included || ok
+		}
+
+		excluded := false
+		for _, pattern := range exclude {
+			ok, err := path.Match(pattern, name)
+			if err != nil {
+				return nil, fmt.Errorf("invalid database pattern %q: %w", pattern, err)
+			}
+			excluded = excluded || ok
+		}
+
+		if included && !excluded {
+			matched = append(matched, name)
+		}
+	}
+	return matched, nil
+}
+
+// parseNames parses one name per line printed by a database shell
+func parseNames(output []byte) []string {
+	var names []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if name := strings.TrimSpace(line); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
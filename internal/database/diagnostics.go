@@ -0,0 +1,245 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Errors classified from native tool output
+var (
+	ErrToolNotFound    = errors.New("native tool not found")
+	ErrAuthFailed      = errors.New("authentication failed")
+	ErrHostUnreachable = errors.New("host unreachable")
+	ErrHostNotFound    = errors.New("host name not found")
+	ErrDatabaseMissing = errors.New("database does not exist")
+	ErrDiskFull        = errors.New("disk full")
+)
+
+// fatalPatterns maps known fatal stderr messages to typed errors
+var fatalPatterns = []struct {
+	pattern *regexp.Regexp
+	err     error
+}{
+	{regexp.MustCompile(`(?i)password authentication failed|access denied for user|authentication failed|auth(entication)? error|no password supplied`), ErrAuthFailed},
+	{regexp.MustCompile(`(?i)database "[^"]*" does not exist|unknown database|ns ?not ?found|unable to open database file`), ErrDatabaseMissing},
+	{regexp.MustCompile(`(?i)no space left on device|could not extend file|disk full|errcode: 28`), ErrDiskFull},
+	// Name resolution failures are permanent unless the resolver itself failed
+	{regexp.MustCompile(`(?i)temporary failure in name resolution|unknown mysql server host '[^']*' \(-?3\)`), ErrHostUnreachable},
+	{regexp.MustCompile(`(?i)could not translate host name|unknown mysql server host|name or service not known|no such host|nodename nor servname provided`), ErrHostNotFound},
+	{regexp.MustCompile(`(?i)could not connect to server|connection refused|can't connect to (local )?mysql server|no route to host|server selection (error|timeout)|connection timed out|i/o timeout|network is unreachable`), ErrHostUnreachable},
+}
+
+// Severity of a native tool stderr line
+type Severity string
+
+const (
+	SeverityDebug Severity = "debug"
+	SeverityWarn  Severity = "warn"
+	SeverityError Severity = "error"
+)
+
+var (
+	errorLine   = regexp.MustCompile(`(?i)\berror\b|\bfatal\b|^failed:`)
+	warningLine = regexp.MustCompile(`(?i)\bwarning\b|deprecated|\bnotice\b`)
+)
+
+// classifyLine returns the severity of a stderr line
+func classifyLine(line string) Severity {
+	switch {
+	case errorLine.MatchString(line):
+		return SeverityError
+	case warningLine.MatchString(line):
+		return SeverityWarn
+	default:
+		return SeverityDebug
+	}
+}
+
+// DiagnosticLines is the number of stderr lines kept by default
+const DiagnosticLines = 20
+
+// toolErrorLines is the number of stderr lines included in a ToolError
+const toolErrorLines = 50
+
+// Diagnostics collects stderr output of the native tools run by a connector.
+// Each line is passed to the handler as it arrives and the last lines are
+// kept for the backup manifest.
+type Diagnostics struct {
+	mu      sync.Mutex
+	handler func(tool string, severity Severity, line string)
+	lines   []string
+	max     int
+}
+
+// NewDiagnostics creates a collector keeping the last max lines.
+// handler may be nil.
+func NewDiagnostics(max int, handler func(tool string, severity Severity, line string)) *Diagnostics {
+	return &Diagnostics{handler: handler, max: max}
+}
+
+// Lines returns the last stderr lines, prefixed with the tool name
+func (d *Diagnostics) Lines() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.lines...)
+}
+
+func (d *Diagnostics) add(tool, line string) {
+	severity := classifyLine(line)
+	if d.handler != nil {
+		d.handler(tool, severity, line)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lines = appendTail(d.lines, fmt.Sprintf("%s: %s", tool, line), d.max)
+}
+
+// ToolError is returned when a native tool fails
+type ToolError struct {
+	Tool   string
+	Err    error    // Error from running the command
+	Stderr []string // Last lines of stderr
+	Kind   error    // Classified error (ErrAuthFailed, ...), nil if unknown
+}
+
+func (e *ToolError) Error() string {
+	if len(e.Stderr) == 0 {
+		return fmt.Sprintf("%s failed: %s", e.Tool, e.Err)
+	}
+	return fmt.Sprintf("%s failed: %s - %s", e.Tool, e.Err, strings.Join(e.Stderr, "\n"))
+}
+
+// Unwrap exposes both the classified error and the underlying command error
+func (e *ToolError) Unwrap() []error {
+	if e.Kind != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Err}
+}
+
+// toolRunner runs native tools for a connector
+type toolRunner struct {
+	diag   *Diagnostics
+	tools  ToolPaths
+	major  int          // Server major version used to select tools, 0 if unknown
+	remote *remoteShell // Runs the tools on an SSH server if set
+}
+
+// command creates a command for a native tool, resolved from the
+// configured tool paths
+func (t *toolRunner) command(name string, args ...string) *exec.Cmd {
+	return exec.Command(t.tools.Path(name, t.major), args...)
+}
+
+// SetDiagnostics routes native tool stderr to d
+func (t *toolRunner) SetDiagnostics(d *Diagnostics) {
+	t.diag = d
+}
+
+// run runs a native tool, streaming its stderr line by line into the
+// diagnostics and classifying failures into typed errors
+func (t *toolRunner) run(cmd *exec.Cmd) error {
+	tool := filepath.Base(cmd.Args[0])
+	stderr := &stderrWriter{tool: tool, diag: t.diag}
+	if cmd.Stderr == nil {
+		cmd.Stderr = stderr
+	}
+
+	var err error
+	if t.remote != nil {
+		err = t.remote.run(cmd)
+	} else {
+		err = cmd.Run()
+	}
+	stderr.flush()
+
+	if err == nil {
+		return nil
+	}
+	return toolError(tool, err, stderr.tail)
+}
+
+// toolError builds the error of a failed native tool, classified from the
+// last lines of its stderr
+func toolError(tool string, err error, stderr []string) error {
+	toolErr := &ToolError{Tool: tool, Err: err, Stderr: stderr}
+	if errors.Is(err, exec.ErrNotFound) || remoteToolMissing(err) {
+		toolErr.Kind = ErrToolNotFound
+		return toolErr
+	}
+
+	output := strings.Join(stderr, "\n")
+	for _, fp := range fatalPatterns {
+		if fp.pattern.MatchString(output) {
+			toolErr.Kind = fp.err
+			break
+		}
+	}
+	return toolErr
+}
+
+// output runs a native tool and returns its stdout, like run
+func (t *toolRunner) output(cmd *exec.Cmd) ([]byte, error) {
+	var stdout strings.Builder
+	cmd.Stdout = &stdout
+	if err := t.run(cmd); err != nil {
+		return nil, err
+	}
+	return []byte(stdout.String()), nil
+}
+
+// stderrWriter splits stderr into lines, forwards them to the
+// diagnostics and keeps the tail for error messages
+type stderrWriter struct {
+	tool string
+	diag *Diagnostics
+	buf  []byte
+	tail []string
+}
+
+func (w *stderrWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.line(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+func (w *stderrWriter) flush() {
+	if len(w.buf) > 0 {
+		w.line(string(w.buf))
+		w.buf = nil
+	}
+}
+
+func (w *stderrWriter) line(line string) {
+	line = RedactURL(strings.TrimRight(line, "\r"))
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	w.tail = appendTail(w.tail, line, toolErrorLines)
+	if w.diag != nil {
+		w.diag.add(w.tool, line)
+	}
+}
+
+// appendTail appends line, keeping at most max lines
+func appendTail(lines []string, line string, max int) []string {
+	lines = append(lines, line)
+	if max > 0 && len(lines) > max {
+		lines = lines[len(lines)-max:]
+	}
+	return lines
+}
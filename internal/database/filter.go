@@ -0,0 +1,93 @@
+package database
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// TableFilter selects the tables of a backup with glob patterns such as
+// "audit_*". PostgreSQL patterns are passed to pg_dump and may be
+// qualified with a schema; the other engines match table (or collection)
+// names.
+type TableFilter struct {
+	IncludeTables    []string `json:"include_tables,omitempty"`
+	ExcludeTables    []string `json:"exclude_tables,omitempty"`
+	IncludeSchemas   []string `json:"include_schemas,omitempty"`    // PostgreSQL only
+	ExcludeTableData []string `json:"exclude_table_data,omitempty"` // Definitions kept, rows left out
+}
+
+// IsEmpty returns true if the filter selects every table
+func (f TableFilter) IsEmpty() bool {
+	return len(f.IncludeTables) == 0 && len(f.ExcludeTables) == 0 &&
+		len(f.IncludeSchemas) == 0 && len(f.ExcludeTableData) == 0
+}
+
+// String describes the filter, e.g. "exclude tables audit_*"
+func (f TableFilter) String() string {
+	var parts []string
+	for _, p := range []struct {
+		label    string
+		patterns []string
+	}{
+		{"include schemas", f.IncludeSchemas},
+		{"include tables", f.IncludeTables},
+		{"exclude tables", f.ExcludeTables},
+		{"exclude data of", f.ExcludeTableData},
+	} {
+		if len(p.patterns) > 0 {
+			parts = append(parts, p.label+" "+strings.Join(p.patterns, ", "))
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+// validateFilter checks the table filter's patterns and that the engine
+// supports it
+func (c Config) validateFilter() error {
+	f := c.Filter
+	if len(f.IncludeSchemas) > 0 && c.Type != "postgres" {
+		return fmt.Errorf("schema filters are only supported for postgres")
+	}
+	if len(f.ExcludeTableData) > 0 && c.Type == "mongodb" {
+		return fmt.Errorf("excluding table data is not supported for mongodb")
+	}
+
+	for _, patterns := range [][]string{f.IncludeTables, f.ExcludeTables, f.IncludeSchemas, f.ExcludeTableData} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid table pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// matchTables splits names into the tables backed up with their data and
+// those backed up without; the others are left out
+func (f TableFilter) matchTables(names []string) (withData, noData []string) {
+	for _, name := range names {
+		if len(f.IncludeTables) > 0 && !matchAny(f.IncludeTables, name) {
+			continue
+		}
+		if matchAny(f.ExcludeTables, name) {
+			continue
+		}
+		if matchAny(f.ExcludeTableData, name) {
+			noData = append(noData, name)
+		} else {
+			withData = append(withData, name)
+		}
+	}
+	return withData, noData
+}
+
+// matchAny returns true if name matches any of the glob patterns
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Dump formats
+const (
+	FormatPlain     = "plain"     // SQL script restored through psql or mysql
+	FormatCustom    = "custom"    // PostgreSQL: pg_dump -F c archive restored through pg_restore
+	FormatDirectory = "directory" // PostgreSQL: pg_dump -F d directory, streamed as a tar archive
+	FormatParallel  = "parallel"  // MySQL: tables dumped and loaded in parallel, see mysql_parallel.go
+	FormatFile      = "file"      // SQLite: consistent copy of the database file, see sqlite_file.go
+)
+
+// errRemoteFiles is returned for operations that need local files when
+// the native tools run on an SSH server
+var errRemoteFiles = errors.New("not supported with remote execution")
+
+// Extensioner is implemented by connectors whose artifacts don't use the
+// default extension of their database type
+type Extensioner interface {
+	// Extension returns the artifact extension, e.g. ".dump"
+	Extension() string
+}
+
+// MemberCompressor is implemented by connectors whose artifacts are
+// archives of compressed members, which aren't compressed again
+type MemberCompressor interface {
+	// CompressesMembers returns true if the artifacts compress their members
+	CompressesMembers() bool
+}
+
+// ContentLister is implemented by connectors that can list the table of
+// contents of a backup
+type ContentLister interface {
+	// ListContents writes the table of contents of the backup read from r
+	ListContents(r io.Reader, w io.Writer) error
+}
+
+// validateFormat checks the dump format and restore settings
+func (c Config) validateFormat() error {
+	switch c.Format {
+	case "", FormatPlain:
+	case FormatCustom, FormatDirectory:
+		if c.Type != "postgres" {
+			return fmt.Errorf("%s dump format is only supported for postgres", c.Format)
+		}
+	case FormatParallel:
+		if c.Type != "mysql" {
+			return fmt.Errorf("%s dump format is only supported for mysql", c.Format)
+		}
+	case FormatFile:
+		if c.Type != "sqlite" {
+			return fmt.Errorf("%s dump format is only supported for sqlite", c.Format)
+		}
+		if c.PartialContent() != "" || !c.Filter.IsEmpty() {
+			return errors.New("the file dump format copies the whole database; use the plain format to back up part of it")
+		}
+	default:
+		return fmt.Errorf("unsupported dump format: %s (use plain, custom or directory for postgres, plain or parallel for mysql, plain or file for sqlite)", c.Format)
+	}
+
+	if c.Jobs < 0 {
+		return fmt.Errorf("jobs must be positive")
+	}
+	return nil
+}
+
+// archiveExtension returns the artifact extension of a dump format, or
+// "" for the default
+func archiveExtension(format string) string {
+	switch format {
+	case FormatCustom:
+		return ".dump"
+	case FormatDirectory, FormatParallel:
+		return ".tar"
+	case FormatFile:
+		return ".db"
+	default:
+		return ""
+	}
+}
+
+// isTar reports whether the stream is a tar archive
+func isTar(r *bufio.Reader) bool {
+	header, err := r.Peek(262)
+	return err == nil && bytes.Equal(header[257:262], []byte("ustar"))
+}
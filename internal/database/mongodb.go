@@ -1,20 +1,24 @@
 package database
 
 import (
+	"bufio"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"os/exec"
+	"slices"
 	"strings"
 )
 
 // MongoDBConnector implements database operations for MongoDB
 type MongoDBConnector struct {
 	config Config
+	toolRunner
 }
 
 // NewMongoDBConnector creates a new MongoDB connector
 func NewMongoDBConnector(config Config) (*MongoDBConnector, error) {
-	return &MongoDBConnector{config: config}, nil
+	return &MongoDBConnector{config: config, toolRunner: toolRunner{tools: config.Tools}}, nil
 }
 
 // TestConnection tests the MongoDB connection
@@ -23,76 +27,210 @@ func (m *MongoDBConnector) TestConnection() error {
 		m.config.ConnectionString(),
 		"--eval", "db.runCommand({ ping: 1 })",
 	}
+	args = append(args, mongoTLSArgs(m.config.TLS)...)
 
-	cmd := exec.Command("mongosh", args...)
-	output, err := cmd.CombinedOutput()
+	if err := m.run(m.command("mongosh", args...)); err != nil {
+		// Try with legacy mongo shell
+		if err := m.run(m.command("mongo", args...)); err != nil {
+			return fmt.Errorf("connection failed: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Size returns the data size of the database as reported by db.stats()
+func (m *MongoDBConnector) Size() (int64, error) {
+	args := []string{
+		m.config.ConnectionString(),
+		"--quiet",
+		"--eval", "db.stats().dataSize",
+	}
+	args = append(args, mongoTLSArgs(m.config.TLS)...)
+
+	output, err := m.output(m.command("mongosh", args...))
 	if err != nil {
 		// Try with legacy mongo shell
-		cmd = exec.Command("mongo", args...)
-		output, err = cmd.CombinedOutput()
+		output, err = m.output(m.command("mongo", args...))
 		if err != nil {
-			return fmt.Errorf("connection failed: %s - %s", err, string(output))
+			return 0, fmt.Errorf("failed to query database size: %w", err)
 		}
 	}
 
-	return nil
+	return parseSize(output)
 }
 
-// Backup performs a MongoDB backup using mongodump
-func (m *MongoDBConnector) Backup(w io.Writer) error {
-	// mongodump writes to archive which we'll stream to the writer
+// ListDatabases returns the databases on the server
+func (m *MongoDBConnector) ListDatabases() ([]string, error) {
 	args := []string{
-		"--host", m.config.Host,
-		"--port", fmt.Sprintf("%d", m.config.Port),
-		"--db", m.config.Database,
-		"--archive", // Output to stdout as archive
+		m.config.ConnectionString(),
+		"--quiet",
+		"--eval", "db.adminCommand({ listDatabases: 1, nameOnly: true }).databases.forEach(function (d) { print(d.name) })",
 	}
+	args = append(args, mongoTLSArgs(m.config.TLS)...)
 
-	if m.config.Username != "" {
-		args = append(args, "--username", m.config.Username)
-		args = append(args, "--password", m.config.Password)
-		args = append(args, "--authenticationDatabase", "admin")
+	output, err := m.output(m.command("mongosh", args...))
+	if err != nil {
+		// Try with legacy mongo shell
+		output, err = m.output(m.command("mongo", args...))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list databases: %w", err)
+		}
 	}
+	return parseNames(output), nil
+}
 
-	cmd := exec.Command("mongodump", args...)
-	cmd.Stdout = w
+// Backup performs a MongoDB backup using mongodump. Schema only backups
+// are a mongosh script recreating the collections and their indexes.
+// mongodump can't leave them out, so data only backups are full archives
+// whose collection options and indexes are skipped on restore.
+func (m *MongoDBConnector) Backup(w io.Writer) error {
+	excluded, err := m.excludedCollections()
+	if err != nil {
+		return err
+	}
 
-	var stderr strings.Builder
-	cmd.Stderr = &stderr
+	if m.config.PartialContent() == ContentSchema {
+		return m.dumpMetadata(w, excluded)
+	}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("mongodump failed: %s - %s", err, stderr.String())
+	// mongodump writes to archive which we'll stream to the writer
+	args := m.buildToolArgs()
+	args = append(args, "--archive") // Output to stdout as archive
+	for _, name := range excluded {
+		args = append(args, "--excludeCollection", name)
 	}
 
-	return nil
+	cmd := m.command("mongodump", args...)
+	cmd.Stdout = w
+
+	return m.run(cmd)
 }
 
 // Restore restores a MongoDB database from backup
 func (m *MongoDBConnector) Restore(r io.Reader) error {
+	content, err := m.config.restoreContent()
+	if err != nil {
+		return err
+	}
+
+	buffered := bufio.NewReader(r)
+	if header, _ := buffered.Peek(len(mongoMetadataHeader)); string(header) == mongoMetadataHeader {
+		if content == ContentData {
+			return errors.New("the backup only holds collection metadata, no data")
+		}
+		return m.restoreMetadata(buffered)
+	}
+
+	args := m.buildToolArgs()
+	args = append(args, "--archive") // Read from stdin as archive
+
+	switch {
+	case content == ContentSchema:
+		return errors.New("restoring only the schema needs a schema only backup for mongodb")
+	case content == ContentData, m.config.BackupContent == ContentData:
+		args = append(args, "--noIndexRestore", "--noOptionsRestore")
+	}
+
+	cmd := m.command("mongorestore", args...)
+	cmd.Stdin = buffered
+
+	return m.run(cmd)
+}
+
+// mongoMetadataHeader is the first line of schema only backups
+const mongoMetadataHeader = "// masstdb: mongodb collection metadata\n"
+
+// mongoMetadataScript prints a mongosh script recreating the collections,
+// views and secondary indexes of the database, collections before views.
+// It expects the names of the collections left out in excluded.
+const mongoMetadataScript = `
+const run = (cmd) => print('db.runCommand(EJSON.parse(' + JSON.stringify(EJSON.stringify(cmd, { relaxed: false })) + '));');
+print('// masstdb: mongodb collection metadata');
+db.getCollectionInfos()
+  .filter((c) => !c.name.startsWith('system.') && !excluded.includes(c.name))
+  .sort((a, b) => (a.type === 'view') - (b.type === 'view'))
+  .forEach((c) => {
+    run(Object.assign({ create: c.name }, c.options));
+    if (c.type === 'view') return;
+    const indexes = db.getCollection(c.name).getIndexes()
+      .filter((i) => i.name !== '_id_')
+      .map((i) => { delete i.v; delete i.ns; return i; });
+    if (indexes.length > 0) run({ createIndexes: c.name, indexes: indexes });
+  });
+`
+
+// dumpMetadata writes the collection metadata script using mongosh,
+// leaving out the excluded collections
+func (m *MongoDBConnector) dumpMetadata(w io.Writer, excluded []string) error {
+	names, err := json.Marshal(append([]string{}, excluded...))
+	if err != nil {
+		return err
+	}
+
 	args := []string{
-		"--host", m.config.Host,
-		"--port", fmt.Sprintf("%d", m.config.Port),
-		"--db", m.config.Database,
-		"--archive", // Read from stdin as archive
+		m.config.ConnectionString(),
+		"--quiet",
+		"--eval", fmt.Sprintf("const excluded = %s;\n%s", names, mongoMetadataScript),
 	}
+	args = append(args, mongoTLSArgs(m.config.TLS)...)
 
-	if m.config.Username != "" {
-		args = append(args, "--username", m.config.Username)
-		args = append(args, "--password", m.config.Password)
-		args = append(args, "--authenticationDatabase", "admin")
+	cmd := m.command("mongosh", args...)
+	cmd.Stdout = w
+
+	return m.run(cmd)
+}
+
+// excludedCollections returns the collections left out by the table
+// filter, none if it is empty
+func (m *MongoDBConnector) excludedCollections() ([]string, error) {
+	if m.config.Filter.IsEmpty() {
+		return nil, nil
 	}
 
-	cmd := exec.Command("mongorestore", args...)
-	cmd.Stdin = r
+	args := []string{
+		m.config.ConnectionString(),
+		"--quiet",
+		"--eval", "db.getCollectionNames().forEach(function (c) { print(c) })",
+	}
+	args = append(args, mongoTLSArgs(m.config.TLS)...)
 
-	var stderr strings.Builder
-	cmd.Stderr = &stderr
+	output, err := m.output(m.command("mongosh", args...))
+	if err != nil {
+		// Try with legacy mongo shell
+		output, err = m.output(m.command("mongo", args...))
+		if err != nil {
+			return nil, fmt.Errorf("failed to list collections: %w", err)
+		}
+	}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("mongorestore failed: %s - %s", err, stderr.String())
+	names := parseNames(output)
+	selected, _ := m.config.Filter.matchTables(names)
+	if len(selected) == 0 {
+		return nil, errors.New("no collections match the filters")
 	}
 
-	return nil
+	var excluded []string
+	for _, name := range names {
+		if !slices.Contains(selected, name) {
+			excluded = append(excluded, name)
+		}
+	}
+	return excluded, nil
+}
+
+// restoreMetadata runs a collection metadata script through mongosh
+func (m *MongoDBConnector) restoreMetadata(r io.Reader) error {
+	args := []string{
+		m.config.ConnectionString(),
+		"--quiet",
+	}
+	args = append(args, mongoTLSArgs(m.config.TLS)...)
+
+	cmd := m.command("mongosh", args...)
+	cmd.Stdin = r
+
+	return m.run(cmd)
 }
 
 // Close closes the MongoDB connection
@@ -100,6 +238,11 @@ func (m *MongoDBConnector) Close() error {
 	return nil
 }
 
+// SetBackupContent records what the backup being restored holds
+func (m *MongoDBConnector) SetBackupContent(content string) {
+	m.config.BackupContent = content
+}
+
 // Type returns the database type
 func (m *MongoDBConnector) Type() string {
 	return "mongodb"
@@ -109,3 +252,33 @@ func (m *MongoDBConnector) Type() string {
 func (m *MongoDBConnector) SupportsIncremental() bool {
 	return false // mongodump doesn't support incremental backups natively
 }
+
+// buildToolArgs builds the connection arguments of mongodump and
+// mongorestore. Connection options, SRV records and replica set seed
+// lists can only be expressed as a URI.
+func (m *MongoDBConnector) buildToolArgs() []string {
+	if m.config.SRV || len(m.config.Options) > 0 || strings.Contains(m.config.Host, ",") {
+		config := m.config
+		if config.Username != "" && config.Options["authSource"] == "" {
+			config.Options = map[string]string{"authSource": "admin"}
+			for key, value := range m.config.Options {
+				config.Options[key] = value
+			}
+		}
+		return append([]string{"--uri", config.ConnectionString()}, mongoTLSArgs(m.config.TLS)...)
+	}
+
+	args := []string{
+		"--host", m.config.Host,
+		"--port", fmt.Sprintf("%d", m.config.Port),
+		"--db", m.config.Database,
+	}
+
+	if m.config.Username != "" {
+		args = append(args, "--username", m.config.Username)
+		args = append(args, "--password", m.config.Password)
+		args = append(args, "--authenticationDatabase", "admin")
+	}
+
+	return append(args, mongoTLSArgs(m.config.TLS)...)
+}
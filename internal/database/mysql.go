@@ -1,20 +1,24 @@
 package database
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"io"
-	"os/exec"
+	"slices"
+	"sort"
 	"strings"
 )
 
 // MySQLConnector implements database operations for MySQL
 type MySQLConnector struct {
 	config Config
+	toolRunner
 }
 
 // NewMySQLConnector creates a new MySQL connector
 func NewMySQLConnector(config Config) (*MySQLConnector, error) {
-	return &MySQLConnector{config: config}, nil
+	return &MySQLConnector{config: config, toolRunner: toolRunner{tools: config.Tools}}, nil
 }
 
 // TestConnection tests the MySQL connection
@@ -22,57 +26,181 @@ func (m *MySQLConnector) TestConnection() error {
 	args := m.buildMysqlArgs()
 	args = append(args, "-e", "SELECT 1")
 
-	cmd := exec.Command("mysql", args...)
+	cmd := m.command("mysql", args...)
 
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("connection failed: %s - %s", err, string(output))
+	if err := m.run(cmd); err != nil {
+		return fmt.Errorf("connection failed: %w", err)
 	}
 
 	return nil
 }
 
-// Backup performs a MySQL backup using mysqldump
+// Size returns the size of the database's tables and indexes
+func (m *MySQLConnector) Size() (int64, error) {
+	args := m.buildMysqlArgs()
+	args = append(args, "-N", "-B", "-e",
+		"SELECT COALESCE(SUM(data_length + index_length), 0) FROM information_schema.tables WHERE table_schema = DATABASE()")
+
+	cmd := m.command("mysql", args...)
+
+	output, err := m.output(cmd)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query database size: %w", err)
+	}
+
+	return parseSize(output)
+}
+
+// ListDatabases returns the databases on the server
+func (m *MySQLConnector) ListDatabases() ([]string, error) {
+	args := m.buildMysqlArgs()
+	args = append(args, "-N", "-B", "-e", "SHOW DATABASES")
+
+	output, err := m.output(m.command("mysql", args...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w", err)
+	}
+	return parseNames(output), nil
+}
+
+// Backup performs a MySQL backup using mysqldump, or dumps the tables in
+// parallel for the parallel format
 func (m *MySQLConnector) Backup(w io.Writer) error {
-	args := []string{
-		"-h", m.config.Host,
-		"-P", fmt.Sprintf("%d", m.config.Port),
-		"-u", m.config.Username,
-		fmt.Sprintf("-p%s", m.config.Password),
-		"--single-transaction", // Consistent backup without locking
-		"--routines",           // Include stored procedures
-		"--triggers",           // Include triggers
-		m.config.Database,
+	if m.config.Format == FormatParallel {
+		return m.backupParallel(w)
 	}
 
-	cmd := exec.Command("mysqldump", args...)
+	flags := []string{"--single-transaction"} // Consistent backup without locking
+	switch m.config.PartialContent() {
+	case ContentSchema:
+		flags = append(flags, "--no-data", "--routines", "--triggers")
+	case ContentData:
+		flags = append(flags, "--no-create-info", "--skip-triggers")
+	default:
+		flags = append(flags,
+			"--routines", // Include stored procedures
+			"--triggers", // Include triggers
+		)
+	}
+	if !m.config.Filter.IsEmpty() {
+		return m.backupFiltered(w, flags)
+	}
+
+	cmd := m.command("mysqldump", m.dumpArgs(flags...)...)
 	cmd.Stdout = w
 
-	var stderr strings.Builder
-	cmd.Stderr = &stderr
+	return m.run(cmd)
+}
+
+// backupFiltered dumps the tables selected by the table filter in a single
+// mysqldump run, so that they all come from the same snapshot. The other
+// tables are skipped with --ignore-table, and tables whose data is
+// excluded with --ignore-table-data (mysqldump 8.0.32 or later, or MariaDB).
+func (m *MySQLConnector) backupFiltered(w io.Writer, flags []string) error {
+	selection, err := m.selectTables()
+	if err != nil {
+		return err
+	}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("mysqldump failed: %s - %s", err, stderr.String())
+	// Data only backups leave out the tables without data altogether
+	content := m.config.PartialContent()
+	keep := [][]string{selection.withData, selection.noData}
+	if content == ContentData {
+		keep = keep[:1]
 	}
+	args := append(flags, selection.ignoreArgs(m.config.Database, keep...)...)
 
-	return nil
+	ignoreData := content == "" && len(selection.noData) > 0
+	if ignoreData {
+		for _, table := range selection.noData {
+			args = append(args, fmt.Sprintf("--ignore-table-data=%s.%s", m.config.Database, table))
+		}
+	}
+
+	cmd := m.command("mysqldump", m.dumpArgs(args...)...)
+	cmd.Stdout = w
+
+	err = m.run(cmd)
+	var toolErr *ToolError
+	if ignoreData && errors.As(err, &toolErr) && slices.ContainsFunc(toolErr.Stderr, func(line string) bool {
+		return strings.Contains(line, "ignore-table-data")
+	}) {
+		return fmt.Errorf("excluding table data needs mysqldump 8.0.32 or later, or MariaDB: %w", err)
+	}
+	return err
 }
 
-// Restore restores a MySQL database from backup
-func (m *MySQLConnector) Restore(r io.Reader) error {
+// tableSelection is the table filter applied to a database
+type tableSelection struct {
+	names            []string // All tables and views
+	withData, noData []string // Selected tables, with and without their data
+}
+
+// selectTables applies the table filter to the tables and views of the
+// database
+func (m *MySQLConnector) selectTables() (*tableSelection, error) {
 	args := m.buildMysqlArgs()
+	args = append(args, "-N", "-B", "-e",
+		"SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE()")
 
-	cmd := exec.Command("mysql", args...)
-	cmd.Stdin = r
+	output, err := m.output(m.command("mysql", args...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
 
-	var stderr strings.Builder
-	cmd.Stderr = &stderr
+	names := parseNames(output)
+	withData, noData := m.config.Filter.matchTables(names)
+	if len(withData) == 0 && len(noData) == 0 {
+		return nil, errors.New("no tables match the filters")
+	}
+	return &tableSelection{names: names, withData: withData, noData: noData}, nil
+}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("restore failed: %s - %s", err, stderr.String())
+// ignoreArgs returns --ignore-table arguments for the tables not kept
+func (s *tableSelection) ignoreArgs(database string, keep ...[]string) []string {
+	kept := map[string]bool{}
+	for _, tables := range keep {
+		for _, table := range tables {
+			kept[table] = true
+		}
 	}
 
-	return nil
+	var args []string
+	for _, name := range s.names {
+		if !kept[name] {
+			args = append(args, fmt.Sprintf("--ignore-table=%s.%s", database, name))
+		}
+	}
+	return args
+}
+
+// Restore restores a MySQL database from backup. SQL scripts are run
+// through mysql; parallel format archives are loaded in parallel.
+func (m *MySQLConnector) Restore(r io.Reader) error {
+	content, err := m.config.restoreContent()
+	if err != nil {
+		return err
+	}
+
+	buffered := bufio.NewReader(r)
+	if isTar(buffered) {
+		return m.restoreParallel(buffered, content)
+	}
+	if content != "" {
+		return errors.New("restoring only the schema or the data needs a parallel format backup")
+	}
+
+	args := m.buildMysqlArgs()
+
+	cmd := m.command("mysql", args...)
+	cmd.Stdin = buffered
+
+	return m.run(cmd)
+}
+
+// SetBackupContent records what the backup being restored holds
+func (m *MySQLConnector) SetBackupContent(content string) {
+	m.config.BackupContent = content
 }
 
 // Close closes the MySQL connection
@@ -92,11 +220,97 @@ func (m *MySQLConnector) SupportsIncremental() bool {
 
 // buildMysqlArgs builds common mysql command arguments
 func (m *MySQLConnector) buildMysqlArgs() []string {
-	return []string{
+	args := []string{
+		"-h", m.config.Host,
+		"-P", fmt.Sprintf("%d", m.config.Port),
+		"-u", m.config.Username,
+		fmt.Sprintf("-p%s", m.config.Password),
+	}
+	args = append(args, mysqlTLSArgs(m.config.TLS)...)
+	args = append(args, m.optionArgs()...)
+	return append(args, m.config.Database)
+}
+
+// dumpArgs builds mysqldump arguments, flags coming before the database
+func (m *MySQLConnector) dumpArgs(flags ...string) []string {
+	args := []string{
 		"-h", m.config.Host,
 		"-P", fmt.Sprintf("%d", m.config.Port),
 		"-u", m.config.Username,
 		fmt.Sprintf("-p%s", m.config.Password),
-		m.config.Database,
 	}
+	args = append(args, flags...)
+	args = append(args, mysqlTLSArgs(m.config.TLS)...)
+	args = append(args, m.optionArgs()...)
+	return append(args, m.config.Database)
+}
+
+// mysqlOptions maps the connection URI options accepted for MySQL to
+// mysql client options. Others, such as Go driver settings like
+// parseTime, aren't client options and are rejected.
+var mysqlOptions = map[string]string{
+	"charset":                "default-character-set",
+	"default-character-set":  "default-character-set",
+	"connect-timeout":        "connect-timeout",
+	"compress":               "compress",
+	"compression-algorithms": "compression-algorithms",
+	"zstd-compression-level": "zstd-compression-level",
+	"protocol":               "protocol",
+	"socket":                 "socket",
+	"max-allowed-packet":     "max-allowed-packet",
+	"net-buffer-length":      "net-buffer-length",
+	"get-server-public-key":  "get-server-public-key",
+	"server-public-key-path": "server-public-key-path",
+	"ssl-mode":               "ssl-mode",
+	"ssl-ca":                 "ssl-ca",
+	"ssl-capath":             "ssl-capath",
+	"ssl-cert":               "ssl-cert",
+	"ssl-key":                "ssl-key",
+	"ssl-cipher":             "ssl-cipher",
+	"ssl-crl":                "ssl-crl",
+	"ssl-crlpath":            "ssl-crlpath",
+	"tls-version":            "tls-version",
+	"tls-ciphersuites":       "tls-ciphersuites",
+}
+
+// mysqlOption returns the mysql client option of a connection URI option.
+// Underscores may be used for dashes, e.g. ssl_mode for ssl-mode.
+func mysqlOption(key string) (string, bool) {
+	name, ok := mysqlOptions[strings.ReplaceAll(strings.ToLower(key), "_", "-")]
+	return name, ok
+}
+
+// validateMySQLOptions rejects connection URI options that aren't
+// supported mysql client options
+func validateMySQLOptions(options map[string]string) error {
+	var unknown []string
+	for key := range options {
+		if _, ok := mysqlOption(key); !ok {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		supported := make([]string, 0, len(mysqlOptions))
+		for key := range mysqlOptions {
+			supported = append(supported, key)
+		}
+		sort.Strings(unknown)
+		sort.Strings(supported)
+		return fmt.Errorf("unsupported mysql connection options: %s (supported: %s)",
+			strings.Join(unknown, ", "), strings.Join(supported, ", "))
+	}
+	return nil
+}
+
+// optionArgs passes connection options to the mysql client tools as long
+// options, e.g. charset=utf8mb4 as --default-character-set=utf8mb4 and
+// ssl-mode=REQUIRED as --ssl-mode=REQUIRED
+func (m *MySQLConnector) optionArgs() []string {
+	var args []string
+	for _, key := range m.config.optionKeys() {
+		if name, ok := mysqlOption(key); ok {
+			args = append(args, fmt.Sprintf("--%s=%s", name, m.config.Options[key]))
+		}
+	}
+	return args
 }
@@ -0,0 +1,792 @@
+package database
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// The parallel format dumps each table over its own connection into a
+// tar archive of gzip-compressed members:
+//
+//	schema.sql.gz       table and view definitions, without triggers
+//	post-data.sql.gz    triggers and routines
+//	tables/<name>.sql.gz  the data of each table as INSERT statements
+//
+// Restores load the tables concurrently and recreate their secondary
+// indexes once the data is in, and triggers last so they don't fire.
+const (
+	schemaMember   = "schema.sql.gz"
+	tableMemberDir = "tables/"
+	postDataMember = "post-data.sql.gz"
+)
+
+// defaultMySQLJobs is the number of connections used by parallel dumps and
+// restores unless --jobs is set
+const defaultMySQLJobs = 4
+
+// Limits of the INSERT statements written by parallel dumps
+const (
+	insertBatchRows  = 1000
+	insertBatchBytes = 1 << 20
+)
+
+// compressesMembers returns true if the config's artifacts are archives of
+// compressed members
+func compressesMembers(config Config) bool {
+	return config.Type == "mysql" && config.Format == FormatParallel
+}
+
+// CompressesMembers returns true for the parallel format
+func (m *MySQLConnector) CompressesMembers() bool {
+	return compressesMembers(m.config)
+}
+
+// Extension returns the artifact extension of the dump format
+func (m *MySQLConnector) Extension() string {
+	return archiveExtension(m.config.Format)
+}
+
+// jobs returns the number of connections of parallel dumps and restores
+func (m *MySQLConnector) jobs() int {
+	if m.config.Jobs > 0 {
+		return m.config.Jobs
+	}
+	return defaultMySQLJobs
+}
+
+// mysqlTable is a base table and the stored columns its data is dumped from
+type mysqlTable struct {
+	name    string
+	columns []mysqlColumn
+}
+
+type mysqlColumn struct {
+	name     string
+	dataType string
+}
+
+// backupParallel writes a parallel format archive to w
+func (m *MySQLConnector) backupParallel(w io.Writer) error {
+	if m.remote != nil {
+		return fmt.Errorf("parallel format is %w", errRemoteFiles)
+	}
+
+	dir, err := os.MkdirTemp("", "masstdb-mysqldump-")
+	if err != nil {
+		return fmt.Errorf("failed to create dump directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The definitions and the table list are read, and the worker sessions
+	// start their snapshots, while one session holds FLUSH TABLES WITH READ
+	// LOCK, so they all see the same point in time. The lock is released
+	// before the table data is dumped.
+	lock, err := m.openSession()
+	if err != nil {
+		return err
+	}
+	defer lock.close()
+	if err := lock.exec("FLUSH TABLES WITH READ LOCK"); err != nil {
+		return fmt.Errorf("failed to lock tables: %w", err)
+	}
+
+	// Tables left out by the filter are ignored throughout; those whose
+	// data is excluded only keep their definitions
+	var selection *tableSelection
+	var ignore []string
+	if !m.config.Filter.IsEmpty() {
+		if selection, err = m.selectTables(); err != nil {
+			return err
+		}
+		ignore = selection.ignoreArgs(m.config.Database, selection.withData, selection.noData)
+	}
+
+	content := m.config.PartialContent()
+	archive := &memberArchive{tw: tar.NewWriter(w), dir: dir}
+	if content != ContentData {
+		err := archive.add(schemaMember, func(w io.Writer) error {
+			return m.dumpDefinitions(w, append([]string{"--skip-triggers"}, ignore...)...)
+		})
+		if err != nil {
+			return err
+		}
+		err = archive.add(postDataMember, func(w io.Writer) error {
+			flags := append([]string{"--no-create-info", "--no-create-db", "--triggers", "--routines"}, ignore...)
+			return m.dumpDefinitions(w, flags...)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	var tables []mysqlTable
+	var sessions []*mysqlSession
+	defer func() { closeSessions(sessions) }()
+	if content != ContentSchema {
+		if tables, err = m.listTables(); err != nil {
+			return err
+		}
+		if selection != nil {
+			tables = slices.DeleteFunc(tables, func(t mysqlTable) bool {
+				return !slices.Contains(selection.withData, t.name)
+			})
+		}
+		if sessions, err = m.snapshotSessions(min(m.jobs(), len(tables))); err != nil {
+			return err
+		}
+	}
+
+	if err := lock.exec("UNLOCK TABLES"); err != nil {
+		return fmt.Errorf("failed to unlock tables: %w", err)
+	}
+	lock.close()
+
+	if err := dumpTables(archive, sessions, tables); err != nil {
+		return err
+	}
+	return archive.close()
+}
+
+// dumpDefinitions runs mysqldump without data, flags selecting which
+// definitions are written. It runs under the global read lock, so the
+// tables aren't locked again.
+func (m *MySQLConnector) dumpDefinitions(w io.Writer, flags ...string) error {
+	cmd := m.command("mysqldump", m.dumpArgs(append([]string{"--no-data", "--skip-lock-tables"}, flags...)...)...)
+	cmd.Stdout = w
+	return m.run(cmd)
+}
+
+// listTables returns the base tables of the database, largest first so
+// they don't end up last on a single worker. Generated columns are left
+// out as they can't be inserted.
+func (m *MySQLConnector) listTables() ([]mysqlTable, error) {
+	args := m.buildMysqlArgs()
+	args = append(args, "-N", "-B", "-e",
+		"SELECT c.TABLE_NAME, c.COLUMN_NAME, c.DATA_TYPE FROM information_schema.COLUMNS c "+
+			"JOIN information_schema.TABLES t ON t.TABLE_SCHEMA = c.TABLE_SCHEMA AND t.TABLE_NAME = c.TABLE_NAME "+
+			"WHERE c.TABLE_SCHEMA = DATABASE() AND t.TABLE_TYPE = 'BASE TABLE' AND c.EXTRA NOT LIKE '%GENERATED%' "+
+			"ORDER BY t.DATA_LENGTH DESC, c.TABLE_NAME, c.ORDINAL_POSITION")
+
+	output, err := m.output(m.command("mysql", args...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
+
+	var tables []mysqlTable
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 3 {
+			continue
+		}
+		if len(tables) == 0 || tables[len(tables)-1].name != fields[0] {
+			tables = append(tables, mysqlTable{name: fields[0]})
+		}
+		last := &tables[len(tables)-1]
+		last.columns = append(last.columns, mysqlColumn{name: fields[1], dataType: fields[2]})
+	}
+	return tables, nil
+}
+
+// snapshotSessions opens n sessions that each start a consistent snapshot
+// transaction. Started under the global read lock, they all see the same
+// data.
+func (m *MySQLConnector) snapshotSessions(n int) ([]*mysqlSession, error) {
+	sessions := make([]*mysqlSession, 0, n)
+	for len(sessions) < n {
+		session, err := m.openSession()
+		if err != nil {
+			closeSessions(sessions)
+			return nil, err
+		}
+		sessions = append(sessions, session)
+
+		err = session.exec("SET SESSION TRANSACTION ISOLATION LEVEL REPEATABLE READ; START TRANSACTION WITH CONSISTENT SNAPSHOT")
+		if err != nil {
+			closeSessions(sessions)
+			return nil, fmt.Errorf("failed to start snapshot: %w", err)
+		}
+	}
+	return sessions, nil
+}
+
+// closeSessions closes each session
+func closeSessions(sessions []*mysqlSession) {
+	for _, session := range sessions {
+		session.close()
+	}
+}
+
+// dumpTables dumps the data of the tables in parallel, one session per
+// worker
+func dumpTables(archive *memberArchive, sessions []*mysqlSession, tables []mysqlTable) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	next := make(chan mysqlTable)
+	errs := make([]error, len(sessions))
+	var failed atomic.Bool
+	var wg sync.WaitGroup
+	for i, session := range sessions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for table := range next {
+				if failed.Load() {
+					continue
+				}
+				err := archive.add(tableMemberDir+table.name+".sql.gz", func(w io.Writer) error {
+					return session.dumpTable(w, table)
+				})
+				if err != nil {
+					errs[i] = fmt.Errorf("failed to dump table %s: %w", table.name, err)
+					failed.Store(true)
+				}
+			}
+		}()
+	}
+	for _, table := range tables {
+		next <- table
+	}
+	close(next)
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// dumpTable writes the rows of table as batched INSERT statements. Values
+// are quoted by the server with QUOTE() and line breaks escaped, so each
+// line the session reads is one complete row.
+func (s *mysqlSession) dumpTable(w io.Writer, table mysqlTable) error {
+	columns := make([]string, len(table.columns))
+	values := make([]string, len(table.columns))
+	for i, column := range table.columns {
+		name := quoteIdentifier(column.name)
+		columns[i] = name
+		if column.dataType == "bit" {
+			values[i] = fmt.Sprintf(`IF(%s IS NULL, 'NULL', CONCAT('b''', BIN(%s), ''''))`, name, name)
+		} else {
+			values[i] = fmt.Sprintf(`REPLACE(REPLACE(QUOTE(%s), '\n', '\\n'), '\r', '\\r')`, name)
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("SET NAMES utf8mb4;\nSET time_zone = '+00:00';\nSET sql_mode = 'NO_AUTO_VALUE_ON_ZERO';\n")
+	bw.WriteString("SET foreign_key_checks = 0;\nSET unique_checks = 0;\n")
+	insert := fmt.Sprintf("INSERT INTO %s (%s) VALUES\n", quoteIdentifier(table.name), strings.Join(columns, ","))
+
+	rows, size := 0, 0
+	query := fmt.Sprintf("SELECT CONCAT('(', CONCAT_WS(',', %s), ')') FROM %s", strings.Join(values, ", "), quoteIdentifier(table.name))
+	err := s.query(query, func(row string) error {
+		if rows == 0 {
+			bw.WriteString(insert)
+		} else {
+			bw.WriteString(",\n")
+		}
+		bw.WriteString(row)
+
+		rows++
+		size += len(row)
+		if rows < insertBatchRows && size < insertBatchBytes {
+			return nil
+		}
+		rows, size = 0, 0
+		_, err := bw.WriteString(";\n")
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if rows > 0 {
+		bw.WriteString(";\n")
+	}
+
+	return bw.Flush()
+}
+
+// restoreParallel restores the content, or all, of a parallel format
+// archive. The table
+// definitions are loaded first, then the tables are loaded concurrently,
+// each after its secondary indexes are dropped, and finally the indexes
+// are added back and the triggers and routines created. Backups without a
+// schema load into existing tables.
+func (m *MySQLConnector) restoreParallel(r io.Reader, content string) error {
+	if m.remote != nil {
+		return fmt.Errorf("parallel format restores are %w", errRemoteFiles)
+	}
+
+	dir, err := os.MkdirTemp("", "masstdb-mysqlrestore-")
+	if err != nil {
+		return fmt.Errorf("failed to create restore directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	pool := newJobPool(m.jobs())
+	var indexes map[string]mysqlIndexes
+	var loading bool
+	var postData string
+
+	// Indexes dropped from the tables loaded so far, added back even if
+	// the restore fails
+	var mu sync.Mutex
+	var dropped []mysqlIndexes
+
+	// Members are spooled to disk one at a time, as the archive is read
+	// sequentially, and loaded once a connection is free
+	readMembers := func() error {
+		tr := tar.NewReader(r)
+		for {
+			header, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read dump archive: %w", err)
+			}
+
+			switch {
+			case header.Name == schemaMember && content != ContentData:
+				if loading {
+					return fmt.Errorf("invalid dump archive: %s after table data", schemaMember)
+				}
+				if err := m.loadMember(tr); err != nil {
+					return fmt.Errorf("failed to load schema: %w", err)
+				}
+
+			case header.Name == postDataMember && content != ContentData:
+				if postData, err = spoolFile(dir, tr); err != nil {
+					return err
+				}
+
+			case strings.HasPrefix(header.Name, tableMemberDir) && content != ContentSchema:
+				if !loading {
+					if indexes, err = m.secondaryIndexes(); err != nil {
+						return err
+					}
+					loading = true
+				}
+
+				path, err := spoolFile(dir, tr)
+				if err != nil {
+					return err
+				}
+				table := strings.TrimSuffix(strings.TrimPrefix(header.Name, tableMemberDir), ".sql.gz")
+				ok := pool.run(func() error {
+					defer os.Remove(path)
+					if t := indexes[table]; len(t.indexes) > 0 {
+						if err := m.alterTableIndexes(t, false); err != nil {
+							return fmt.Errorf("failed to drop secondary indexes of %s: %w", table, err)
+						}
+						mu.Lock()
+						dropped = append(dropped, t)
+						mu.Unlock()
+					}
+					if err := m.loadFile(path); err != nil {
+						return fmt.Errorf("failed to load table %s: %w", table, err)
+					}
+					return nil
+				})
+				if !ok {
+					return nil
+				}
+			}
+		}
+	}
+	err = readMembers()
+	if waitErr := pool.wait(); err == nil {
+		err = waitErr
+	}
+	if addErr := m.addIndexes(dropped); addErr != nil {
+		err = errors.Join(err, fmt.Errorf("failed to recreate secondary indexes: %w", addErr))
+	}
+	if err != nil {
+		return err
+	}
+
+	if postData != "" {
+		if err := m.loadFile(postData); err != nil {
+			return fmt.Errorf("failed to load triggers and routines: %w", err)
+		}
+	}
+	return nil
+}
+
+// loadMember runs a compressed SQL member through mysql
+func (m *MySQLConnector) loadMember(r io.Reader) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("invalid dump archive member: %w", err)
+	}
+	defer gz.Close()
+
+	args := m.buildMysqlArgs()
+	args = append(args, "--default-character-set=utf8mb4")
+
+	cmd := m.command("mysql", args...)
+	cmd.Stdin = gz
+
+	return m.run(cmd)
+}
+
+// loadFile runs a spooled compressed SQL member through mysql
+func (m *MySQLConnector) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+	return m.loadMember(file)
+}
+
+// spoolFile writes r to a new temporary file in dir and returns its path
+func spoolFile(dir string, r io.Reader) (string, error) {
+	file, err := os.CreateTemp(dir, "member-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create spool file: %w", err)
+	}
+	path := file.Name()
+	file.Close()
+
+	if err := writeFile(path, r); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// mysqlIndexes are the secondary indexes of a table
+type mysqlIndexes struct {
+	table   string
+	indexes []mysqlIndex
+}
+
+// mysqlIndex is a secondary index definition
+type mysqlIndex struct {
+	name  string
+	kind  string   // INDEX, UNIQUE INDEX, FULLTEXT INDEX or SPATIAL INDEX
+	parts []string // Quoted columns with prefix lengths and order
+}
+
+// secondaryIndexes returns the secondary indexes that can be dropped while
+// the data is loaded, by table. Tables with foreign keys, on either side, keep
+// their indexes as the constraints need them, and so do functional
+// indexes, which can't be rebuilt from the column list.
+func (m *MySQLConnector) secondaryIndexes() (map[string]mysqlIndexes, error) {
+	args := m.buildMysqlArgs()
+	args = append(args, "-N", "-B", "-e",
+		"SELECT TABLE_NAME, INDEX_NAME, NON_UNIQUE, INDEX_TYPE, COLUMN_NAME, SUB_PART, COLLATION "+
+			"FROM information_schema.STATISTICS WHERE TABLE_SCHEMA = DATABASE() AND INDEX_NAME <> 'PRIMARY' "+
+			"AND TABLE_NAME NOT IN (SELECT TABLE_NAME FROM information_schema.KEY_COLUMN_USAGE "+
+			"WHERE TABLE_SCHEMA = DATABASE() AND REFERENCED_TABLE_NAME IS NOT NULL) "+
+			"AND TABLE_NAME NOT IN (SELECT REFERENCED_TABLE_NAME FROM information_schema.KEY_COLUMN_USAGE "+
+			"WHERE REFERENCED_TABLE_SCHEMA = DATABASE() AND REFERENCED_TABLE_NAME IS NOT NULL) "+
+			"ORDER BY TABLE_NAME, INDEX_NAME, SEQ_IN_INDEX")
+
+	output, err := m.output(m.command("mysql", args...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secondary indexes: %w", err)
+	}
+
+	var tables []mysqlIndexes
+	functional := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			continue
+		}
+		table, name, nonUnique, indexType, column, subPart, collation := fields[0], fields[1], fields[2], fields[3], fields[4], fields[5], fields[6]
+
+		if len(tables) == 0 || tables[len(tables)-1].table != table {
+			tables = append(tables, mysqlIndexes{table: table})
+		}
+		t := &tables[len(tables)-1]
+		if len(t.indexes) == 0 || t.indexes[len(t.indexes)-1].name != name {
+			kind := "INDEX"
+			switch {
+			case indexType == "FULLTEXT" || indexType == "SPATIAL":
+				kind = indexType + " INDEX"
+			case nonUnique == "0":
+				kind = "UNIQUE INDEX"
+			}
+			t.indexes = append(t.indexes, mysqlIndex{name: name, kind: kind})
+		}
+
+		if column == "NULL" {
+			functional[table+"\x00"+name] = true
+			continue
+		}
+		part := quoteIdentifier(column)
+		if subPart != "NULL" {
+			part += "(" + subPart + ")"
+		}
+		if collation == "D" {
+			part += " DESC"
+		}
+		index := &t.indexes[len(t.indexes)-1]
+		index.parts = append(index.parts, part)
+	}
+
+	indexes := make(map[string]mysqlIndexes, len(tables))
+	for _, t := range tables {
+		kept := t.indexes[:0]
+		for _, index := range t.indexes {
+			if !functional[t.table+"\x00"+index.name] {
+				kept = append(kept, index)
+			}
+		}
+		t.indexes = kept
+		indexes[t.table] = t
+	}
+	return indexes, nil
+}
+
+// addIndexes adds the secondary indexes back, running tables in parallel.
+// Each table is attempted even if another fails.
+func (m *MySQLConnector) addIndexes(tables []mysqlIndexes) error {
+	errs := make([]error, len(tables))
+	pool := newJobPool(m.jobs())
+	for i, t := range tables {
+		pool.run(func() error {
+			errs[i] = m.alterTableIndexes(t, true)
+			return nil
+		})
+	}
+	pool.wait()
+	return errors.Join(errs...)
+}
+
+// alterTableIndexes adds or drops the secondary indexes of a table with one
+// ALTER TABLE
+func (m *MySQLConnector) alterTableIndexes(t mysqlIndexes, add bool) error {
+	if len(t.indexes) == 0 {
+		return nil
+	}
+
+	clauses := make([]string, len(t.indexes))
+	for i, index := range t.indexes {
+		if add {
+			clauses[i] = fmt.Sprintf("ADD %s %s (%s)", index.kind, quoteIdentifier(index.name), strings.Join(index.parts, ", "))
+		} else {
+			clauses[i] = "DROP INDEX " + quoteIdentifier(index.name)
+		}
+	}
+	statement := fmt.Sprintf("ALTER TABLE %s %s", quoteIdentifier(t.table), strings.Join(clauses, ", "))
+
+	args := m.buildMysqlArgs()
+	args = append(args, "-e", statement)
+	return m.run(m.command("mysql", args...))
+}
+
+// quoteIdentifier quotes a MySQL identifier with backticks
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// memberArchive writes gzip-compressed members to a tar stream. Members
+// are compressed to temporary files first, as tar headers carry their
+// size, and may be added concurrently.
+type memberArchive struct {
+	mu  sync.Mutex
+	tw  *tar.Writer
+	dir string
+}
+
+// add writes the output of dump as the member name
+func (a *memberArchive) add(name string, dump func(io.Writer) error) error {
+	file, err := os.CreateTemp(a.dir, "member-")
+	if err != nil {
+		return fmt.Errorf("failed to create spool file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	gz := gzip.NewWriter(file)
+	if err := dump(gz); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to compress %s: %w", name, err)
+	}
+
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to spool %s: %w", name, err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to spool %s: %w", name, err)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	header := &tar.Header{Name: name, Mode: 0600, Size: size, ModTime: time.Now(), Typeflag: tar.TypeReg}
+	if err := a.tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write dump archive: %w", err)
+	}
+	if _, err := io.Copy(a.tw, file); err != nil {
+		return fmt.Errorf("failed to write dump archive: %w", err)
+	}
+	return nil
+}
+
+func (a *memberArchive) close() error {
+	if err := a.tw.Close(); err != nil {
+		return fmt.Errorf("failed to write dump archive: %w", err)
+	}
+	return nil
+}
+
+// mysqlSession is a mysql client kept running to send statements over one
+// connection, e.g. to hold a lock or a transaction between statements.
+// Rows are read in batch mode, one per line.
+type mysqlSession struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	stderr *stderrWriter
+	marks  int
+	closed bool
+}
+
+// openSession starts a mysql client session
+func (m *MySQLConnector) openSession() (*mysqlSession, error) {
+	args := m.buildMysqlArgs()
+	args = append(args, "--batch", "--skip-column-names", "--raw",
+		"--default-character-set=utf8mb4", "--max-allowed-packet=1G")
+
+	cmd := m.command("mysql", args...)
+	session := &mysqlSession{cmd: cmd, stderr: &stderrWriter{tool: "mysql", diag: m.diag}}
+	cmd.Stderr = session.stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start mysql session: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start mysql session: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, toolError("mysql", err, nil)
+	}
+
+	session.stdin = stdin
+	session.stdout = bufio.NewReaderSize(stdout, 1<<20)
+
+	if err := session.exec("SET time_zone = '+00:00'"); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// query runs statements and passes each row they return to row. The end
+// of the output is found by selecting a marker after the statements.
+func (s *mysqlSession) query(statements string, row func(line string) error) error {
+	s.marks++
+	mark := fmt.Sprintf("masstdb-mark-%d", s.marks)
+	if _, err := fmt.Fprintf(s.stdin, "%s;\nSELECT '%s';\n", statements, mark); err != nil {
+		return s.fail(err)
+	}
+
+	for {
+		line, err := s.stdout.ReadString('\n')
+		if err != nil {
+			return s.fail(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == mark {
+			return nil
+		}
+		if err := row(line); err != nil {
+			s.cmd.Process.Kill()
+			s.close()
+			return err
+		}
+	}
+}
+
+// exec runs statements that return no rows
+func (s *mysqlSession) exec(statements string) error {
+	return s.query(statements, func(string) error { return nil })
+}
+
+// fail ends a session whose client stopped and returns its error, mysql
+// exiting on the first failed statement
+func (s *mysqlSession) fail(err error) error {
+	s.closed = true
+	s.stdin.Close()
+	if waitErr := s.cmd.Wait(); waitErr != nil {
+		err = waitErr
+	}
+	s.stderr.flush()
+	return toolError("mysql", err, s.stderr.tail)
+}
+
+// close ends the session, rolling back any open transaction
+func (s *mysqlSession) close() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.stdin.Close()
+	s.cmd.Wait()
+}
+
+// jobPool runs functions on at most n goroutines and keeps the first error
+type jobPool struct {
+	slots chan struct{}
+	wg    sync.WaitGroup
+	mu    sync.Mutex
+	err   error
+}
+
+func newJobPool(n int) *jobPool {
+	return &jobPool{slots: make(chan struct{}, max(n, 1))}
+}
+
+// run waits for a free goroutine and runs fn on it. Once a function has
+// failed, run returns false without running fn.
+func (p *jobPool) run(fn func() error) bool {
+	p.slots <- struct{}{}
+	if p.failed() {
+		<-p.slots
+		return false
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		defer func() { <-p.slots }()
+		if err := fn(); err != nil {
+			p.mu.Lock()
+			if p.err == nil {
+				p.err = err
+			}
+			p.mu.Unlock()
+		}
+	}()
+	return true
+}
+
+func (p *jobPool) failed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err != nil
+}
+
+// wait waits for the running functions and returns the first error
+func (p *jobPool) wait() error {
+	p.wg.Wait()
+	return p.err
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"archive/tar"
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// detectFormat tells the dump format of a backup stream from its first
+// bytes: custom archives start with "PGDMP" and tar archives have "ustar"
+// at offset 257
+func detectFormat(r *bufio.Reader) string {
+	if magic, err := r.Peek(5); err == nil && string(magic) == "PGDMP" {
+		return FormatCustom
+	}
+	if isTar(r) {
+		return FormatDirectory
+	}
+	return FormatPlain
+}
+
+// tarDir writes the regular files of dir to w as a tar archive
+func tarDir(dir string, w io.Writer) error {
+	tw := tar.NewWriter(w)
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(name)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to archive dump directory: %w", err)
+	}
+
+	return tw.Close()
+}
+
+// untarDir extracts the regular files of a tar archive into dir
+func untarDir(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read dump archive: %w", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := filepath.FromSlash(header.Name)
+		if !filepath.IsLocal(name) || strings.ContainsRune(name, os.PathSeparator) {
+			return fmt.Errorf("unexpected file in dump archive: %s", header.Name)
+		}
+
+		file, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to extract dump archive: %w", err)
+		}
+		_, err = io.Copy(file, tr)
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("failed to extract dump archive: %w", err)
+		}
+	}
+}
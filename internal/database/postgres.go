@@ -1,20 +1,36 @@
 package database
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"io"
-	"os/exec"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 )
 
 // PostgresConnector implements database operations for PostgreSQL
 type PostgresConnector struct {
-	config Config
+	config   Config
+	hostAddr string // Address of the host when connecting by TLS server name
+	toolRunner
 }
 
-// NewPostgresConnector creates a new PostgreSQL connector
+// NewPostgresConnector creates a new PostgreSQL connector. With a TLS
+// server name, the host is resolved up front as libpq connects to its
+// address.
 func NewPostgresConnector(config Config) (*PostgresConnector, error) {
-	return &PostgresConnector{config: config}, nil
+	p := &PostgresConnector{config: config, toolRunner: toolRunner{tools: config.Tools}}
+	if config.TLS.ServerName != "" {
+		addr, err := resolveHost(config.Host)
+		if err != nil {
+			return nil, err
+		}
+		p.hostAddr = addr
+	}
+	return p, nil
 }
 
 // TestConnection tests the PostgreSQL connection
@@ -23,60 +39,360 @@ func (p *PostgresConnector) TestConnection() error {
 	args := p.buildPsqlArgs()
 	args = append(args, "-c", "SELECT 1")
 
-	cmd := exec.Command("psql", args...)
+	cmd := p.command("psql", args...)
+	cmd.Env = p.buildEnv()
+
+	if err := p.run(cmd); err != nil {
+		return fmt.Errorf("connection failed: %w", err)
+	}
+
+	return nil
+}
+
+// Size returns the size of the database as reported by pg_database_size
+func (p *PostgresConnector) Size() (int64, error) {
+	args := p.buildPsqlArgs()
+	args = append(args, "-t", "-A", "-c", "SELECT pg_database_size(current_database())")
+
+	cmd := p.command("psql", args...)
 	cmd.Env = p.buildEnv()
 
-	output, err := cmd.CombinedOutput()
+	output, err := p.output(cmd)
 	if err != nil {
-		return fmt.Errorf("connection failed: %s - %s", err, string(output))
+		return 0, fmt.Errorf("failed to query database size: %w", err)
 	}
 
+	return parseSize(output)
+}
+
+// ServerVersionNum returns the server's server_version_num, e.g. 160002
+func (p *PostgresConnector) ServerVersionNum() (int, error) {
+	args := p.buildPsqlArgs()
+	args = append(args, "-t", "-A", "-c", "SHOW server_version_num")
+
+	cmd := p.command("psql", args...)
+	cmd.Env = p.buildEnv()
+
+	output, err := p.output(cmd)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query server version: %w", err)
+	}
+
+	value := strings.TrimSpace(string(output))
+	version, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("unexpected server version output: %q", value)
+	}
+	return version, nil
+}
+
+// ListDatabases returns the databases on the server that accept
+// connections
+func (p *PostgresConnector) ListDatabases() ([]string, error) {
+	args := p.buildPsqlArgs()
+	args = append(args, "-t", "-A", "-c", "SELECT datname FROM pg_database WHERE datallowconn AND NOT datistemplate ORDER BY datname")
+
+	cmd := p.command("psql", args...)
+	cmd.Env = p.buildEnv()
+
+	output, err := p.output(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w", err)
+	}
+	return parseNames(output), nil
+}
+
+// selectTools picks the pg_dump and psql matching the server's major
+// version when tool paths are configured per version
+func (p *PostgresConnector) selectTools() error {
+	if len(p.tools.Versions) == 0 || p.major != 0 {
+		return nil
+	}
+
+	version, err := p.ServerVersionNum()
+	if err != nil {
+		return err
+	}
+	p.major = version / 10000
+
 	return nil
 }
 
-// Backup performs a PostgreSQL backup using pg_dump
+// Backup performs a PostgreSQL backup using pg_dump, as a plain SQL
+// script, a custom format archive or a tarred directory format dump.
+// Archives are left uncompressed by pg_dump; compression is up to the
+// backup service.
 func (p *PostgresConnector) Backup(w io.Writer) error {
+	if err := p.selectTools(); err != nil {
+		return err
+	}
+
 	// Build pg_dump command
 	args := []string{
-		"-h", p.config.Host,
+		"-h", p.host(),
 		"-p", fmt.Sprintf("%d", p.config.Port),
 		"-U", p.config.Username,
-		"-d", p.config.Database,
-		"-F", "p", // plain text format
+		"-d", p.dbname(),
 		"--no-password",
 	}
 
-	cmd := exec.Command("pg_dump", args...)
+	args = append(args, p.contentArgs()...)
+	args = append(args, p.filterArgs()...)
+
+	switch p.config.Format {
+	case FormatCustom:
+		args = append(args, "-F", "c", "-Z", "0")
+	case FormatDirectory:
+		return p.backupDirectory(w, args)
+	default:
+		args = append(args, "-F", "p") // plain text format
+	}
+
+	cmd := p.command("pg_dump", args...)
 	cmd.Stdout = w
 	cmd.Env = p.buildEnv()
 
-	var stderr strings.Builder
-	cmd.Stderr = &stderr
+	return p.run(cmd)
+}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("pg_dump failed: %s - %s", err, stderr.String())
+// backupDirectory dumps in directory format, in parallel with --jobs,
+// into a temporary directory and streams it to w as a tar archive
+func (p *PostgresConnector) backupDirectory(w io.Writer, args []string) error {
+	if p.remote != nil {
+		return fmt.Errorf("directory format is %w", errRemoteFiles)
 	}
 
-	return nil
+	dir, err := os.MkdirTemp("", "masstdb-pgdump-")
+	if err != nil {
+		return fmt.Errorf("failed to create dump directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	args = append(args, "-F", "d", "-Z", "0", "-f", dir)
+	if p.config.Jobs > 1 {
+		args = append(args, "-j", strconv.Itoa(p.config.Jobs))
+	}
+
+	cmd := p.command("pg_dump", args...)
+	cmd.Env = p.buildEnv()
+	if err := p.run(cmd); err != nil {
+		return err
+	}
+
+	return tarDir(dir, w)
 }
 
-// Restore restores a PostgreSQL database from backup
+// Restore restores a PostgreSQL database from backup. Plain SQL scripts
+// are run through psql; custom and directory format archives are restored
+// with pg_restore, in parallel with --jobs.
 func (p *PostgresConnector) Restore(r io.Reader) error {
+	if err := p.selectTools(); err != nil {
+		return err
+	}
+
+	content, err := p.config.restoreContent()
+	if err != nil {
+		return err
+	}
+
+	buffered := bufio.NewReader(r)
+	format := detectFormat(buffered)
+	if format != FormatPlain {
+		return p.pgRestore(buffered, format, p.config.Jobs > 1, p.restoreArgs(), nil)
+	}
+
+	if len(p.config.Tables) > 0 || p.config.UseList != "" || p.config.Clean || content != "" {
+		return errors.New("selective and clean restores need a custom or directory format backup")
+	}
+
 	// Build psql command for restore
 	args := p.buildPsqlArgs()
 
-	cmd := exec.Command("psql", args...)
-	cmd.Stdin = r
+	cmd := p.command("psql", args...)
+	cmd.Stdin = buffered
 	cmd.Env = p.buildEnv()
 
-	var stderr strings.Builder
-	cmd.Stderr = &stderr
+	return p.run(cmd)
+}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("restore failed: %s - %s", err, stderr.String())
+// ListContents writes the table of contents of a custom or directory
+// format backup using pg_restore -l. The output can be edited and passed
+// back with --use-list to select and reorder what is restored.
+func (p *PostgresConnector) ListContents(r io.Reader, w io.Writer) error {
+	buffered := bufio.NewReader(r)
+	format := detectFormat(buffered)
+	if format == FormatPlain {
+		return errors.New("plain SQL backups have no table of contents")
 	}
 
-	return nil
+	return p.pgRestore(buffered, format, false, []string{"-l"}, w)
+}
+
+// Extension returns the artifact extension of the dump format
+func (p *PostgresConnector) Extension() string {
+	return archiveExtension(p.config.Format)
+}
+
+// restoreArgs builds the pg_restore arguments of a restore
+func (p *PostgresConnector) restoreArgs() []string {
+	args := p.buildPsqlArgs()
+	if p.config.Jobs > 1 {
+		args = append(args, "-j", strconv.Itoa(p.config.Jobs))
+	}
+	if p.config.Clean {
+		args = append(args, "--clean", "--if-exists")
+	}
+	args = append(args, p.contentArgs()...)
+	for _, table := range p.config.Tables {
+		args = append(args, "-t", table)
+	}
+	if p.config.UseList != "" {
+		args = append(args, "-L", p.config.UseList)
+	}
+	return args
+}
+
+// contentArgs selects the schema or the data in pg_dump and pg_restore
+func (p *PostgresConnector) contentArgs() []string {
+	switch p.config.PartialContent() {
+	case ContentSchema:
+		return []string{"--schema-only"}
+	case ContentData:
+		return []string{"--data-only"}
+	default:
+		return nil
+	}
+}
+
+// filterArgs maps the table filter to pg_dump switches
+func (p *PostgresConnector) filterArgs() []string {
+	var args []string
+	for _, schema := range p.config.Filter.IncludeSchemas {
+		args = append(args, "-n", schema)
+	}
+	for _, table := range p.config.Filter.IncludeTables {
+		args = append(args, "-t", table)
+	}
+	for _, table := range p.config.Filter.ExcludeTables {
+		args = append(args, "-T", table)
+	}
+	for _, table := range p.config.Filter.ExcludeTableData {
+		args = append(args, "--exclude-table-data="+table)
+	}
+	return args
+}
+
+// pgRestore runs pg_restore on an archive read from r. Directory format
+// archives, and custom format archives restored in parallel, are
+// extracted to a temporary location first as pg_restore can't read them
+// from stdin.
+func (p *PostgresConnector) pgRestore(r io.Reader, format string, parallel bool, args []string, stdout io.Writer) error {
+	cmd := p.command("pg_restore")
+	if format == FormatCustom && !parallel {
+		args = append(args, "-F", "c")
+		cmd.Stdin = r
+	} else {
+		if p.remote != nil {
+			return fmt.Errorf("parallel and directory format restores are %w", errRemoteFiles)
+		}
+
+		dir, err := os.MkdirTemp("", "masstdb-pgrestore-")
+		if err != nil {
+			return fmt.Errorf("failed to create restore directory: %w", err)
+		}
+		defer os.RemoveAll(dir)
+
+		if format == FormatDirectory {
+			if err := untarDir(r, dir); err != nil {
+				return err
+			}
+			args = append(args, "-F", "d", dir)
+		} else {
+			path := filepath.Join(dir, "backup.dump")
+			if err := writeFile(path, r); err != nil {
+				return err
+			}
+			args = append(args, "-F", "c", path)
+		}
+	}
+
+	cmd.Args = append(cmd.Args, args...)
+	cmd.Stdout = stdout
+	cmd.Env = p.buildEnv()
+
+	return p.run(cmd)
+}
+
+// writeFile writes r to a new file at path
+func writeFile(path string, r io.Reader) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return file.Close()
+}
+
+// DumpGlobals dumps the roles and tablespaces of the cluster using
+// pg_dumpall --globals-only
+func (p *PostgresConnector) DumpGlobals(w io.Writer, noRolePasswords bool) error {
+	if err := p.selectTools(); err != nil {
+		return err
+	}
+
+	args := []string{
+		"-h", p.host(),
+		"-p", fmt.Sprintf("%d", p.config.Port),
+		"-U", p.config.Username,
+		"--globals-only",
+		"--no-password",
+	}
+	// pg_dumpall's -d only takes a connection string
+	if len(p.config.Options) > 0 {
+		args = append(args, "-d", p.dbname())
+	} else {
+		args = append(args, "-l", p.config.Database)
+	}
+	if noRolePasswords {
+		args = append(args, "--no-role-passwords")
+	}
+
+	cmd := p.command("pg_dumpall", args...)
+	cmd.Stdout = w
+	cmd.Env = p.buildEnv()
+
+	return p.run(cmd)
+}
+
+// RestoreGlobals restores globals through the postgres maintenance
+// database, as the backed up database may not exist yet. Globals that
+// already exist are reported and skipped by psql.
+func (p *PostgresConnector) RestoreGlobals(r io.Reader) error {
+	if err := p.selectTools(); err != nil {
+		return err
+	}
+
+	args := []string{
+		"-h", p.host(),
+		"-p", fmt.Sprintf("%d", p.config.Port),
+		"-U", p.config.Username,
+		"-d", p.conninfo(maintenanceDatabases["postgres"]),
+		"--no-password",
+	}
+
+	cmd := p.command("psql", args...)
+	cmd.Stdin = r
+	cmd.Env = p.buildEnv()
+
+	return p.run(cmd)
+}
+
+// SetBackupContent records what the backup being restored holds
+func (p *PostgresConnector) SetBackupContent(content string) {
+	p.config.BackupContent = content
 }
 
 // Close closes the PostgreSQL connection (no persistent connection to close)
@@ -97,17 +413,52 @@ func (p *PostgresConnector) SupportsIncremental() bool {
 // buildPsqlArgs builds common psql command arguments
 func (p *PostgresConnector) buildPsqlArgs() []string {
 	return []string{
-		"-h", p.config.Host,
+		"-h", p.host(),
 		"-p", fmt.Sprintf("%d", p.config.Port),
 		"-U", p.config.Username,
-		"-d", p.config.Database,
+		"-d", p.dbname(),
 		"--no-password",
 	}
 }
 
+// dbname returns the -d argument: the database name, or a connection
+// string when connection options such as sslmode are set
+func (p *PostgresConnector) dbname() string {
+	return p.conninfo(p.config.Database)
+}
+
+// conninfo returns the -d argument connecting to database with the
+// connection options
+func (p *PostgresConnector) conninfo(database string) string {
+	if len(p.config.Options) == 0 {
+		return database
+	}
+
+	conn := "dbname=" + conninfoQuote(database)
+	for _, key := range p.config.optionKeys() {
+		conn += fmt.Sprintf(" %s=%s", key, conninfoQuote(p.config.Options[key]))
+	}
+	return conn
+}
+
+// conninfoQuote quotes a value for a libpq connection string
+func conninfoQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// host returns the -h argument. With a TLS server name, libpq verifies
+// the certificate against it and connects to PGHOSTADDR instead.
+func (p *PostgresConnector) host() string {
+	if p.config.TLS.ServerName != "" {
+		return p.config.TLS.ServerName
+	}
+	return p.config.Host
+}
+
 // buildEnv builds environment variables for pg commands
 func (p *PostgresConnector) buildEnv() []string {
-	return []string{
+	env := []string{
 		fmt.Sprintf("PGPASSWORD=%s", p.config.Password),
 	}
+	return append(env, postgresTLSEnv(p.config.TLS, p.hostAddr)...)
 }
@@ -0,0 +1,175 @@
+package database
+
+import (
+	"fmt"
+	"io"
+)
+
+// ServerVersioner is implemented by connectors that report the server's
+// version number
+type ServerVersioner interface {
+	ServerVersionNum() (int, error)
+}
+
+// proxyConnector runs each operation with a connector created for it by
+// open, e.g. one reaching the database through an SSH tunnel. The release
+// function returned by open is called once the operation ends.
+type proxyConnector struct {
+	config        Config
+	diag          *Diagnostics
+	backupContent string
+	open          func() (Connector, func(), error)
+}
+
+// with runs fn with a connector opened for one operation
+func (p *proxyConnector) with(fn func(Connector) error) error {
+	connector, release, err := p.open()
+	if err != nil {
+		return err
+	}
+	defer release()
+	defer connector.Close()
+
+	if receiver, ok := connector.(DiagnosticsReceiver); ok && p.diag != nil {
+		receiver.SetDiagnostics(p.diag)
+	}
+	if receiver, ok := connector.(BackupContentReceiver); ok {
+		receiver.SetBackupContent(p.backupContent)
+	}
+
+	return fn(connector)
+}
+
+// TestConnection tests the connection
+func (p *proxyConnector) TestConnection() error {
+	return p.with(func(c Connector) error {
+		return c.TestConnection()
+	})
+}
+
+// Backup performs a backup
+func (p *proxyConnector) Backup(w io.Writer) error {
+	return p.with(func(c Connector) error {
+		return c.Backup(w)
+	})
+}
+
+// Restore restores a backup
+func (p *proxyConnector) Restore(r io.Reader) error {
+	return p.with(func(c Connector) error {
+		return c.Restore(r)
+	})
+}
+
+// Size returns the size of the database if the connector can report it
+func (p *proxyConnector) Size() (int64, error) {
+	var size int64
+	err := p.with(func(c Connector) error {
+		sizer, ok := c.(Sizer)
+		if !ok {
+			return fmt.Errorf("%s does not report its size", p.config.Type)
+		}
+		var err error
+		size, err = sizer.Size()
+		return err
+	})
+	return size, err
+}
+
+// ServerVersionNum returns the server version if the connector reports it
+func (p *proxyConnector) ServerVersionNum() (int, error) {
+	var version int
+	err := p.with(func(c Connector) error {
+		versioner, ok := c.(ServerVersioner)
+		if !ok {
+			return fmt.Errorf("%s does not report its version", p.config.Type)
+		}
+		var err error
+		version, err = versioner.ServerVersionNum()
+		return err
+	})
+	return version, err
+}
+
+// ListDatabases lists the databases if the connector can list them
+func (p *proxyConnector) ListDatabases() ([]string, error) {
+	var names []string
+	err := p.with(func(c Connector) error {
+		lister, ok := c.(Lister)
+		if !ok {
+			return fmt.Errorf("%s does not list its databases", p.config.Type)
+		}
+		var err error
+		names, err = lister.ListDatabases()
+		return err
+	})
+	return names, err
+}
+
+// DumpGlobals dumps the cluster globals if the connector supports them
+func (p *proxyConnector) DumpGlobals(w io.Writer, noRolePasswords bool) error {
+	return p.with(func(c Connector) error {
+		dumper, ok := c.(GlobalsDumper)
+		if !ok {
+			return fmt.Errorf("%s has no cluster globals", p.config.Type)
+		}
+		return dumper.DumpGlobals(w, noRolePasswords)
+	})
+}
+
+// RestoreGlobals restores the cluster globals if the connector supports them
+func (p *proxyConnector) RestoreGlobals(r io.Reader) error {
+	return p.with(func(c Connector) error {
+		dumper, ok := c.(GlobalsDumper)
+		if !ok {
+			return fmt.Errorf("%s has no cluster globals", p.config.Type)
+		}
+		return dumper.RestoreGlobals(r)
+	})
+}
+
+// ListContents lists the contents of a backup if the connector can
+func (p *proxyConnector) ListContents(r io.Reader, w io.Writer) error {
+	return p.with(func(c Connector) error {
+		lister, ok := c.(ContentLister)
+		if !ok {
+			return fmt.Errorf("%s backups have no table of contents", p.config.Type)
+		}
+		return lister.ListContents(r, w)
+	})
+}
+
+// Extension returns the artifact extension of the dump format
+func (p *proxyConnector) Extension() string {
+	return archiveExtension(p.config.Format)
+}
+
+// CompressesMembers returns true if the artifacts compress their members
+func (p *proxyConnector) CompressesMembers() bool {
+	return compressesMembers(p.config)
+}
+
+// SetDiagnostics routes native tool stderr to d
+func (p *proxyConnector) SetDiagnostics(d *Diagnostics) {
+	p.diag = d
+}
+
+// SetBackupContent records what the backup being restored holds
+func (p *proxyConnector) SetBackupContent(content string) {
+	p.backupContent = content
+}
+
+// Close closes the connector (connectors are closed after each operation)
+func (p *proxyConnector) Close() error {
+	return nil
+}
+
+// Type returns the database type
+func (p *proxyConnector) Type() string {
+	return p.config.Type
+}
+
+// SupportsIncremental returns true if incremental backups are supported
+func (p *proxyConnector) SupportsIncremental() bool {
+	return false
+}
@@ -0,0 +1,266 @@
+package database
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/AdityaNarayan29/masstDB/internal/tunnel"
+)
+
+// CompressedBackuper is implemented by connectors that compress the
+// backup themselves, e.g. on the database host before it crosses the
+// network
+type CompressedBackuper interface {
+	// BackupCompressed writes a gzip-compressed backup to w
+	BackupCompressed(w io.Writer) error
+}
+
+// remoteConnector runs the native tools on an SSH server, usually the
+// database host, instead of locally. Each operation connects to the
+// server and disconnects afterwards.
+type remoteConnector struct {
+	proxyConnector
+}
+
+// newRemoteConnector creates a connector running the native tools on the
+// SSH server of the configuration. Host and port are as seen from there.
+func newRemoteConnector(config Config) (*remoteConnector, error) {
+	if config.SSHTunnel != nil {
+		return nil, errors.New("remote execution can't be combined with an SSH tunnel")
+	}
+	if config.Type == "sqlite" {
+		return nil, errors.New("remote execution is not supported for sqlite")
+	}
+
+	r := &remoteConnector{proxyConnector{config: config}}
+	r.open = func() (Connector, func(), error) {
+		client, err := tunnel.Connect(*config.RemoteExec)
+		if err != nil {
+			return nil, nil, tunnelError(err)
+		}
+
+		tls, tlsDir, err := copyTLSFiles(client, config.TLS)
+		if err != nil {
+			client.Close()
+			return nil, nil, err
+		}
+		release := func() {
+			if tlsDir != "" {
+				client.Run("rm -rf -- "+tunnel.Quote(tlsDir), nil, nil, nil)
+			}
+			client.Close()
+		}
+
+		remote := config
+		remote.RemoteExec = nil
+		remote.Tools = ToolPaths{} // Found on the PATH of the server
+		remote.TLS = tls
+
+		connector, err := NewConnector(remote)
+		if err != nil {
+			release()
+			return nil, nil, err
+		}
+		shell := &remoteShell{client: client, secrets: remoteSecrets(config)}
+		connector.(interface{ setRemote(*remoteShell) }).setRemote(shell)
+		return connector, release, nil
+	}
+	return r, nil
+}
+
+// copyTLSFiles copies the TLS CA, certificate and key files into a private
+// temporary directory on the server, where the native tools read them.
+// Returns the TLS settings pointing at the copies and the directory, or
+// "" if no files are configured.
+func copyTLSFiles(client *tunnel.Client, t TLSConfig) (TLSConfig, string, error) {
+	files := []struct {
+		path *string
+		name string
+	}{
+		{&t.CAFile, "ca.pem"},
+		{&t.CertFile, "cert.pem"},
+		{&t.KeyFile, "key.pem"},
+	}
+	if t.CAFile == "" && t.CertFile == "" && t.KeyFile == "" {
+		return t, "", nil
+	}
+
+	var output strings.Builder
+	if err := client.Run("umask 077 && mktemp -d", nil, &output, nil); err != nil {
+		return t, "", fmt.Errorf("failed to create a directory for the TLS files on the server: %w", err)
+	}
+	dir := strings.TrimSpace(output.String())
+
+	for _, file := range files {
+		if *file.path == "" {
+			continue
+		}
+		data, err := os.ReadFile(*file.path)
+		if err == nil {
+			remotePath := dir + "/" + file.name
+			err = client.Run("umask 077 && cat > "+tunnel.Quote(remotePath), bytes.NewReader(data), nil, nil)
+			*file.path = remotePath
+		}
+		if err != nil {
+			client.Run("rm -rf -- "+tunnel.Quote(dir), nil, nil, nil)
+			return t, "", fmt.Errorf("failed to copy TLS file %s to the server: %w", file.name, err)
+		}
+	}
+	return t, dir, nil
+}
+
+// FindTool looks up a native tool on the PATH of the server and reports
+// its version
+func (r *remoteConnector) FindTool(name string) (*ToolInfo, error) {
+	client, err := tunnel.Connect(*r.config.RemoteExec)
+	if err != nil {
+		return nil, tunnelError(err)
+	}
+	defer client.Close()
+
+	var path strings.Builder
+	if err := client.Run("command -v "+tunnel.Quote(name), nil, &path, nil); err != nil {
+		return nil, fmt.Errorf("%s on %s: %w", name, r.config.RemoteExec.Host, ErrToolNotFound)
+	}
+	info := &ToolInfo{Path: strings.TrimSpace(path.String())}
+
+	var output strings.Builder
+	if err := client.Run(tunnel.Quote(info.Path)+" --version", nil, &output, &output); err != nil {
+		return info, fmt.Errorf("failed to get %s version: %w", name, err)
+	}
+	info.setVersion(output.String())
+	return info, nil
+}
+
+// BackupCompressed runs the dump on the server piped through gzip, so
+// only compressed bytes are transferred
+func (r *remoteConnector) BackupCompressed(w io.Writer) error {
+	return r.Backup(&compressedWriter{w})
+}
+
+// compressedWriter marks the output of a native tool to be compressed on
+// the server
+type compressedWriter struct {
+	io.Writer
+}
+
+// remoteShell runs native tools over an SSH connection
+type remoteShell struct {
+	client  *tunnel.Client
+	secrets []string // Values to keep off the command line, e.g. the password
+}
+
+// remoteSecrets returns the secrets of a configuration as they can appear
+// in native tool arguments: the password, also escaped as in a URI
+func remoteSecrets(config Config) []string {
+	if config.Password == "" {
+		return nil
+	}
+	escaped := strings.TrimPrefix(url.UserPassword("", config.Password).String(), ":")
+	return []string{config.Password, escaped}
+}
+
+// run runs cmd on the server with its environment, arguments and streams.
+// The command line of the server's shell is visible to its other users,
+// so the environment and arguments holding secrets are sent ahead of the
+// input instead, see shellCommand.
+func (r *remoteShell) run(cmd *exec.Cmd) error {
+	prefix, values, command, err := shellCommand(cmd.Env, cmd.Args, r.secrets)
+	if err != nil {
+		return err
+	}
+	if _, ok := cmd.Stdout.(*compressedWriter); ok {
+		command = gzipCommand(command)
+	}
+
+	stdin := io.Reader(strings.NewReader(values))
+	if cmd.Stdin != nil {
+		stdin = io.MultiReader(stdin, cmd.Stdin)
+	}
+	return r.client.Run(prefix+command, stdin, cmd.Stdout, cmd.Stderr)
+}
+
+// setRemote makes the runner run the native tools through shell
+func (t *toolRunner) setRemote(shell *remoteShell) {
+	t.remote = shell
+}
+
+// shellCommand builds a POSIX shell command line running args with the
+// env variables set, without putting their values or arguments holding
+// secrets on the line. The prefix reads them from stdin, one per line in
+// values, and the command refers to them as shell variables. The rest of
+// stdin is left to the command.
+func shellCommand(env, args, secrets []string) (prefix, values, command string, err error) {
+	var names, lines []string
+	read := func(name, value string) error {
+		if strings.ContainsAny(value, "\n\r") {
+			return fmt.Errorf("can't pass %s with a line break to a remote command", name)
+		}
+		names = append(names, name)
+		lines = append(lines, value+"\n")
+		return nil
+	}
+
+	exported := 0
+	for _, variable := range env {
+		name, value, _ := strings.Cut(variable, "=")
+		if err := read(name, value); err != nil {
+			return "", "", "", err
+		}
+		exported++
+	}
+
+	words := make([]string, 0, len(args))
+	for i, arg := range args {
+		if !containsAny(arg, secrets) {
+			words = append(words, tunnel.Quote(arg))
+			continue
+		}
+		name := fmt.Sprintf("MASSTDB_ARG_%d", i)
+		if err := read(name, arg); err != nil {
+			return "", "", "", err
+		}
+		words = append(words, `"$`+name+`"`)
+	}
+
+	if len(names) > 0 {
+		reads := make([]string, len(names))
+		for i, name := range names {
+			reads[i] = "IFS= read -r " + name
+		}
+		prefix = "{ " + strings.Join(reads, " && ") + "; } || exit 125; "
+		if exported > 0 {
+			prefix += "export " + strings.Join(names[:exported], " ") + "; "
+		}
+	}
+	return prefix, strings.Join(lines, ""), strings.Join(words, " "), nil
+}
+
+// containsAny reports whether s contains any of the non-empty substrings
+func containsAny(s string, substrings []string) bool {
+	for _, sub := range substrings {
+		if sub != "" && strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// gzipCommand pipes the output of command through gzip and exits with
+// the status of command rather than of gzip
+func gzipCommand(command string) string {
+	return fmt.Sprintf("exec 3>&1; status=$( { { %s; echo $? >&4; } | gzip -c >&3; } 4>&1 ); exit $status", command)
+}
+
+// remoteToolMissing reports whether a remote command failed because the
+// shell couldn't find it
+func remoteToolMissing(err error) bool {
+	status, ok := tunnel.ExitStatus(err)
+	return ok && status == 127
+}
@@ -1,21 +1,24 @@
 package database
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"os/exec"
+	"strconv"
 	"strings"
 )
 
 // SQLiteConnector implements database operations for SQLite
 type SQLiteConnector struct {
 	config Config
+	toolRunner
 }
 
 // NewSQLiteConnector creates a new SQLite connector
 func NewSQLiteConnector(config Config) (*SQLiteConnector, error) {
-	return &SQLiteConnector{config: config}, nil
+	return &SQLiteConnector{config: config, toolRunner: toolRunner{tools: config.Tools}}, nil
 }
 
 // TestConnection tests if the SQLite database file exists and is accessible
@@ -33,46 +36,142 @@ func (s *SQLiteConnector) TestConnection() error {
 		return fmt.Errorf("path is a directory, not a database file: %s", s.config.Database)
 	}
 
+	if s.config.Format == FormatFile {
+		return s.pingFile()
+	}
+
 	// Try to open the database with sqlite3
-	cmd := exec.Command("sqlite3", s.config.Database, "SELECT 1")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("failed to open database: %s - %s", err, string(output))
+	cmd := s.command("sqlite3", s.config.Database, "SELECT 1")
+	if err := s.run(cmd); err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
 	}
 
 	return nil
 }
 
-// Backup performs a SQLite backup using .dump command
+// Size returns the size of the database file
+func (s *SQLiteConnector) Size() (int64, error) {
+	info, err := os.Stat(s.config.Database)
+	if err != nil {
+		return 0, fmt.Errorf("cannot access database file: %w", err)
+	}
+	return info.Size(), nil
+}
+
+// Backup performs a SQLite backup using .dump command, or .schema for
+// the schema only. The file format copies the database file instead, see
+// sqlite_file.go.
 func (s *SQLiteConnector) Backup(w io.Writer) error {
+	if s.config.Format == FormatFile {
+		return s.backupFile(w)
+	}
+
 	// Use sqlite3 .dump command to create SQL backup
-	cmd := exec.Command("sqlite3", s.config.Database, ".dump")
+	commands := []string{".dump"}
+	switch s.config.PartialContent() {
+	case ContentSchema:
+		commands = []string{".schema --nosys"}
+	case ContentData:
+		commands = []string{".dump --data-only"}
+	}
+
+	if !s.config.Filter.IsEmpty() {
+		var err error
+		if commands, err = s.filteredCommands(); err != nil {
+			return err
+		}
+	}
+
+	cmd := s.command("sqlite3", append([]string{s.config.Database}, commands...)...)
 	cmd.Stdout = w
 
-	var stderr strings.Builder
-	cmd.Stderr = &stderr
+	return s.run(cmd)
+}
+
+// filteredCommands builds the dot commands dumping the tables selected by
+// the table filter: .dump for tables with their data and .schema for the
+// others
+func (s *SQLiteConnector) filteredCommands() ([]string, error) {
+	cmd := s.command("sqlite3", s.config.Database,
+		`SELECT name FROM sqlite_master WHERE type IN ('table', 'view') AND name NOT LIKE 'sqlite\_%' ESCAPE '\'`)
+	output, err := s.output(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tables: %w", err)
+	}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("sqlite3 dump failed: %s - %s", err, stderr.String())
+	withData, noData := s.config.Filter.matchTables(parseNames(output))
+	if len(withData) == 0 && len(noData) == 0 {
+		return nil, errors.New("no tables match the filters")
 	}
 
-	return nil
+	content := s.config.PartialContent()
+	if content == ContentSchema {
+		withData, noData = nil, append(withData, noData...)
+	}
+
+	var commands []string
+	if len(withData) > 0 {
+		dump := ".dump "
+		if content == ContentData {
+			dump = ".dump --data-only "
+		}
+		commands = append(commands, dump+dotArgs(withData))
+	}
+	if content != ContentData {
+		for _, table := range noData {
+			commands = append(commands, ".schema --nosys "+dotArgs([]string{table}))
+		}
+	}
+	if len(commands) == 0 {
+		return nil, errors.New("no table data matches the filters")
+	}
+	return commands, nil
+}
+
+// likeEscaper escapes the wildcards of a LIKE pattern with backslashes
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// dotArgs quotes names as arguments of .dump and .schema, which take LIKE
+// patterns escaped with backslashes, so "a_b" doesn't also match "axb"
+func dotArgs(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = strconv.Quote(likeEscaper.Replace(name))
+	}
+	return strings.Join(quoted, " ")
 }
 
-// Restore restores a SQLite database from backup
+// Restore restores a SQLite database from backup: database file copies
+// replace the database file, SQL dumps are executed with sqlite3
 func (s *SQLiteConnector) Restore(r io.Reader) error {
+	content, err := s.config.restoreContent()
+	if err != nil {
+		return err
+	}
+	if content != "" {
+		return errors.New("restoring only the schema or the data is not supported for sqlite; back up only the content needed instead")
+	}
+
+	buffered := bufio.NewReader(r)
+	if isSQLiteFile(buffered) {
+		return s.restoreFile(buffered)
+	}
+
 	// Use sqlite3 to execute the SQL dump
-	cmd := exec.Command("sqlite3", s.config.Database)
-	cmd.Stdin = r
+	cmd := s.command("sqlite3", s.config.Database)
+	cmd.Stdin = buffered
 
-	var stderr strings.Builder
-	cmd.Stderr = &stderr
+	return s.run(cmd)
+}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("restore failed: %s - %s", err, stderr.String())
-	}
+// Extension returns the artifact extension of the dump format
+func (s *SQLiteConnector) Extension() string {
+	return archiveExtension(s.config.Format)
+}
 
-	return nil
+// SetBackupContent records what the backup being restored holds
+func (s *SQLiteConnector) SetBackupContent(content string) {
+	s.config.BackupContent = content
 }
 
 // Close closes the SQLite connection
@@ -0,0 +1,239 @@
+package database
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/AdityaNarayan29/masstDB/internal/storage"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// sqliteMagic is the header every SQLite database file starts with
+const sqliteMagic = "SQLite format 3\x00"
+
+// sqliteBusyTimeout is how long the embedded driver waits for locks held
+// by other connections, in milliseconds
+const sqliteBusyTimeout = 10000
+
+// openSQLite opens a database file with the embedded driver. query holds
+// extra SQLite URI parameters, e.g. "mode=ro".
+func openSQLite(path, query string) (*sql.DB, error) {
+	if query != "" {
+		query += "&"
+	}
+	uri := url.URL{
+		Scheme:   "file",
+		OmitHost: true,
+		Path:     path,
+		RawQuery: query + fmt.Sprintf("_pragma=busy_timeout(%d)", sqliteBusyTimeout),
+	}
+
+	db, err := sql.Open("sqlite", uri.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+	return db, nil
+}
+
+// pingFile checks that the database file can be read with the embedded
+// driver, without the sqlite3 CLI
+func (s *SQLiteConnector) pingFile() error {
+	db, err := openSQLite(s.config.Database, "mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var tables int
+	if err := db.QueryRow("SELECT count(*) FROM sqlite_master").Scan(&tables); err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	return nil
+}
+
+// backupFile copies the database file with the SQLite online backup API
+// into a temporary file and streams the copy to w. All pages are copied
+// in one step within one read transaction, so the copy is a consistent
+// snapshot that includes commits still in the -wal file, even while other
+// connections write to the database.
+func (s *SQLiteConnector) backupFile(w io.Writer) error {
+	dir, err := os.MkdirTemp("", "masstdb-sqlite-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "backup.db")
+
+	db, err := openSQLite(s.config.Database, "mode=ro")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer conn.Close()
+
+	err = conn.Raw(func(driverConn any) error {
+		backuper, ok := driverConn.(interface {
+			NewBackup(dstUri string) (*sqlite.Backup, error)
+		})
+		if !ok {
+			return errors.New("driver does not support online backups")
+		}
+
+		bk, err := backuper.NewBackup(path)
+		if err != nil {
+			return err
+		}
+		if _, err := bk.Step(-1); err != nil {
+			bk.Finish()
+			return err
+		}
+		return bk.Finish()
+	})
+	if err != nil {
+		return fmt.Errorf("online backup failed: %w", err)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open database copy: %w", err)
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(w, file); err != nil {
+		return fmt.Errorf("failed to write database copy: %w", err)
+	}
+	return nil
+}
+
+// isSQLiteFile reports whether the stream is a database file copy rather
+// than a SQL script
+func isSQLiteFile(r *bufio.Reader) bool {
+	header, err := r.Peek(len(sqliteMagic))
+	return err == nil && string(header) == sqliteMagic
+}
+
+// restoreFile swaps a database file copy in for the database. The copy is
+// written and synced next to the database, checked, then renamed over it,
+// so the database is never seen half restored. The replaced database is
+// checkpointed first, and its -wal, -shm and -journal files are removed
+// once the copy is in place, as SQLite would otherwise apply them to the
+// restored file. Connections to the database must be closed, they keep
+// using the replaced file.
+func (s *SQLiteConnector) restoreFile(r io.Reader) error {
+	target := s.config.Database
+	dir := filepath.Dir(target)
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(target)+".restore-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	_, err = io.Copy(tmp, r)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write database file: %w", err)
+	}
+
+	if err := checkSQLiteFile(tmpPath); err != nil {
+		return err
+	}
+
+	// Keep the permissions of the replaced database
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(target); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.Chmod(tmpPath, mode); err != nil {
+		return fmt.Errorf("failed to set database file permissions: %w", err)
+	}
+
+	if err := checkpointSQLite(target); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, target); err != nil {
+		return fmt.Errorf("failed to replace database file: %w", err)
+	}
+	for _, suffix := range []string{"-wal", "-shm", "-journal"} {
+		if err := os.Remove(target + suffix); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove %s: %w", target+suffix, err)
+		}
+	}
+	return storage.SyncDir(dir)
+}
+
+// checkpointSQLite writes the -wal file of the database at path back into
+// it and truncates it, so the database is whole on its own. A busy
+// checkpoint means other connections are using the database. Files that
+// aren't readable databases, e.g. corrupted ones, are left as they are.
+func checkpointSQLite(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+
+	db, err := openSQLite(path, "")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var busy, frames, checkpointed int
+	err = db.QueryRow("PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &frames, &checkpointed)
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() & 0xff {
+		case sqlite3.SQLITE_NOTADB, sqlite3.SQLITE_CORRUPT:
+			return nil
+		case sqlite3.SQLITE_BUSY:
+			busy = 1
+			err = nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to checkpoint database: %w", err)
+	}
+	if busy != 0 {
+		return errors.New("database is in use; close its connections before restoring the file")
+	}
+	return nil
+}
+
+// checkSQLiteFile runs a quick integrity check of a database file copy.
+// The file is opened immutable so no -wal or -shm file is created for it.
+func checkSQLiteFile(path string) error {
+	db, err := openSQLite(path, "mode=ro&immutable=1")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var result string
+	if err := db.QueryRow("PRAGMA quick_check").Scan(&result); err != nil {
+		return fmt.Errorf("invalid database file: %w", err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("database file failed its integrity check: %s", result)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// TLS modes, named after libpq's sslmode
+const (
+	TLSDisable    = "disable"     // Never use TLS
+	TLSPrefer     = "prefer"      // Use TLS if the server supports it
+	TLSRequire    = "require"     // Require TLS without verifying the certificate
+	TLSVerifyCA   = "verify-ca"   // Require TLS and verify the certificate chain
+	TLSVerifyFull = "verify-full" // Also verify the server's host name
+)
+
+// TLSConfig holds the TLS settings of a connection
+type TLSConfig struct {
+	Mode       string // disable, prefer, require, verify-ca or verify-full; empty uses the tool's default
+	CAFile     string // CA certificates to verify the server with
+	CertFile   string // Client certificate
+	KeyFile    string // Client key
+	ServerName string // Host name to verify instead of the connection host
+}
+
+// Enabled returns true if any TLS setting is configured
+func (t TLSConfig) Enabled() bool {
+	return t != TLSConfig{} && t.Mode != TLSDisable
+}
+
+// validate checks the TLS mode
+func (t TLSConfig) validate() error {
+	switch t.Mode {
+	case "", TLSDisable, TLSPrefer, TLSRequire, TLSVerifyCA, TLSVerifyFull:
+		return nil
+	default:
+		return fmt.Errorf("unsupported TLS mode: %s (use disable, prefer, require, verify-ca or verify-full)", t.Mode)
+	}
+}
+
+// mysqlSSLModes maps TLS modes to mysql --ssl-mode values
+var mysqlSSLModes = map[string]string{
+	TLSDisable:    "DISABLED",
+	TLSPrefer:     "PREFERRED",
+	TLSRequire:    "REQUIRED",
+	TLSVerifyCA:   "VERIFY_CA",
+	TLSVerifyFull: "VERIFY_IDENTITY",
+}
+
+// postgresTLSEnv maps TLS settings to libpq environment variables. With a
+// server name, libpq connects to hostAddr, the resolved address of the
+// host, but verifies the certificate against the server name.
+func postgresTLSEnv(t TLSConfig, hostAddr string) []string {
+	var env []string
+	if t.Mode != "" {
+		env = append(env, "PGSSLMODE="+t.Mode)
+	}
+	if t.CAFile != "" {
+		env = append(env, "PGSSLROOTCERT="+t.CAFile)
+	}
+	if t.CertFile != "" {
+		env = append(env, "PGSSLCERT="+t.CertFile)
+	}
+	if t.KeyFile != "" {
+		env = append(env, "PGSSLKEY="+t.KeyFile)
+	}
+	if hostAddr != "" {
+		env = append(env, "PGHOSTADDR="+hostAddr)
+	}
+	return env
+}
+
+// mysqlTLSArgs maps TLS settings to mysql and mysqldump options
+func mysqlTLSArgs(t TLSConfig) []string {
+	var args []string
+	if t.Mode != "" {
+		args = append(args, "--ssl-mode="+mysqlSSLModes[t.Mode])
+	}
+	if t.CAFile != "" {
+		args = append(args, "--ssl-ca="+t.CAFile)
+	}
+	if t.CertFile != "" {
+		args = append(args, "--ssl-cert="+t.CertFile)
+	}
+	if t.KeyFile != "" {
+		args = append(args, "--ssl-key="+t.KeyFile)
+	}
+	return args
+}
+
+// mongoTLSArgs maps TLS settings to the options of the mongo tools and
+// shells. The client certificate and key must be in one PEM file.
+func mongoTLSArgs(t TLSConfig) []string {
+	if !t.Enabled() || t.Mode == TLSPrefer {
+		return nil
+	}
+
+	args := []string{"--tls"}
+	switch t.Mode {
+	case TLSRequire:
+		args = append(args, "--tlsAllowInvalidCertificates")
+	case TLSVerifyCA:
+		args = append(args, "--tlsAllowInvalidHostnames")
+	}
+	if t.CAFile != "" {
+		args = append(args, "--tlsCAFile", t.CAFile)
+	}
+	if t.CertFile != "" {
+		args = append(args, "--tlsCertificateKeyFile", t.CertFile)
+	}
+	return args
+}
+
+// resolveHost returns the first address of a host, or the host itself if
+// it is already an IP address
+func resolveHost(host string) (string, error) {
+	if net.ParseIP(host) != nil {
+		return host, nil
+	}
+
+	addrs, err := net.LookupHost(host)
+	if err == nil && len(addrs) == 0 {
+		err = &net.DNSError{Err: "no addresses", Name: host, IsNotFound: true}
+	}
+	if err != nil {
+		kind := ErrHostUnreachable
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+			kind = ErrHostNotFound
+		}
+		return "", fmt.Errorf("%w: failed to resolve %s: %w", kind, host, err)
+	}
+	return addrs[0], nil
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Tool describes a native tool used by a connector
+type Tool struct {
+	Name   string
+	Engine string
+	Legacy bool // Fallback for an older tool, not required when its replacement is present
+}
+
+// Tools lists the native tools the connectors shell out to
+var Tools = []Tool{
+	{Name: "pg_dump", Engine: "postgres"},
+	{Name: "psql", Engine: "postgres"},
+	{Name: "pg_dumpall", Engine: "postgres"},
+	{Name: "pg_restore", Engine: "postgres"},
+	{Name: "mysqldump", Engine: "mysql"},
+	{Name: "mysql", Engine: "mysql"},
+	{Name: "mongodump", Engine: "mongodb"},
+	{Name: "mongorestore", Engine: "mongodb"},
+	{Name: "mongosh", Engine: "mongodb"},
+	{Name: "mongo", Engine: "mongodb", Legacy: true},
+	{Name: "sqlite3", Engine: "sqlite"},
+}
+
+// ToolPaths locates the native tools of an engine. Tools missing from the
+// configured directories are looked up on PATH.
+type ToolPaths struct {
+	Dir      string         // Directory searched before PATH
+	Versions map[int]string // Directories by server major version
+}
+
+// dirs returns the directories to search for a server major version (0
+// if unknown). Tools at least as new as the server are required, so the
+// closest versions not older than the server come first. If the server
+// version is unknown, the default directory and then the newest tools are
+// preferred.
+func (t ToolPaths) dirs(major int) []string {
+	versions := make([]int, 0, len(t.Versions))
+	for version := range t.Versions {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+
+	var dirs []string
+	if major > 0 {
+		for _, version := range versions {
+			if version >= major {
+				dirs = append(dirs, t.Versions[version])
+			}
+		}
+		return append(dirs, t.Dir)
+	}
+
+	dirs = append(dirs, t.Dir)
+	for i := len(versions) - 1; i >= 0; i-- {
+		dirs = append(dirs, t.Versions[versions[i]])
+	}
+	return dirs
+}
+
+// Path returns the binary to run for a tool and server major version
+func (t ToolPaths) Path(name string, major int) string {
+	for _, dir := range t.dirs(major) {
+		if dir == "" {
+			continue
+		}
+		if path, err := exec.LookPath(filepath.Join(dir, name)); err == nil {
+			return path
+		}
+	}
+	return name
+}
+
+// ToolInfo describes an installed native tool
+type ToolInfo struct {
+	Path    string
+	Version string // e.g. "16.2", empty if it couldn't be determined
+	Output  string // First line of the version output
+}
+
+// Major returns the major version number, or 0 if unknown
+func (t *ToolInfo) Major() int {
+	major, _ := strconv.Atoi(strings.SplitN(t.Version, ".", 2)[0])
+	return major
+}
+
+var (
+	// mysqldump 5.x reports its own version before "Distrib <server version>"
+	distribVersion = regexp.MustCompile(`Distrib (\d+(?:\.\d+)+)`)
+	toolVersion    = regexp.MustCompile(`v?(\d+(?:\.\d+)+)`)
+)
+
+// ToolFinder is implemented by connectors that run the native tools
+// elsewhere than on the local PATH, e.g. on an SSH server
+type ToolFinder interface {
+	// FindTool looks up a native tool where the connector runs it
+	FindTool(name string) (*ToolInfo, error)
+}
+
+// FindTool looks up a native tool in the tool paths or on PATH and
+// reports its version
+func FindTool(name string, paths ToolPaths, major int) (*ToolInfo, error) {
+	path, err := exec.LookPath(paths.Path(name, major))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, ErrToolNotFound)
+	}
+
+	info := &ToolInfo{Path: path}
+
+	output, err := exec.Command(path, "--version").CombinedOutput()
+	if err != nil {
+		return info, fmt.Errorf("failed to get %s version: %w", name, err)
+	}
+
+	info.setVersion(string(output))
+
+	return info, nil
+}
+
+// setVersion records the version reported by the tool's --version output
+func (t *ToolInfo) setVersion(output string) {
+	t.Output = strings.TrimSpace(strings.SplitN(output, "\n", 2)[0])
+	t.Version = parseVersion(output)
+}
+
+// parseVersion extracts a dotted version number from tool output
+func parseVersion(output string) string {
+	if m := distribVersion.FindStringSubmatch(output); m != nil {
+		return m[1]
+	}
+	if m := toolVersion.FindStringSubmatch(output); m != nil {
+		return m[1]
+	}
+	return ""
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/AdityaNarayan29/masstDB/internal/tunnel"
+)
+
+// newTunnelConnector creates a connector reaching the database through
+// the SSH tunnel of the configuration. The tunnel is opened before each
+// operation and torn down afterwards.
+func newTunnelConnector(config Config) (*proxyConnector, error) {
+	if config.SRV || config.Type == "sqlite" || strings.Contains(config.Host, ",") {
+		return nil, fmt.Errorf("SSH tunnels are not supported for %s", config.Type)
+	}
+
+	p := &proxyConnector{config: config}
+	p.open = func() (Connector, func(), error) {
+		remote := net.JoinHostPort(config.Host, strconv.Itoa(config.Port))
+		tun, err := tunnel.Open(*config.SSHTunnel, remote)
+		if err != nil {
+			return nil, nil, tunnelError(err)
+		}
+
+		local := config
+		local.SSHTunnel = nil
+		local.Host = "127.0.0.1"
+		local.Port = tun.Port()
+
+		// Certificates are issued for the database host, not the tunnel
+		if local.TLS.ServerName == "" && local.TLS.Mode == TLSVerifyFull && local.Type == "postgres" {
+			local.TLS.ServerName = config.Host
+		}
+
+		connector, err := NewConnector(local)
+		if err != nil {
+			tun.Close()
+			return nil, nil, err
+		}
+		return connector, func() { tun.Close() }, nil
+	}
+	return p, nil
+}
+
+// tunnelError classifies failures to connect to an SSH server
+func tunnelError(err error) error {
+	var opErr *net.OpError
+	var dnsErr *net.DNSError
+	switch {
+	case errors.As(err, &dnsErr) && dnsErr.IsNotFound:
+		return fmt.Errorf("%w: %w", ErrHostNotFound, err)
+	case errors.As(err, &opErr):
+		return fmt.Errorf("%w: %w", ErrHostUnreachable, err)
+	case strings.Contains(err.Error(), "unable to authenticate"):
+		return fmt.Errorf("%w: %w", ErrAuthFailed, err)
+	default:
+		return err
+	}
+}
@@ -0,0 +1,80 @@
+package failure
+
+import (
+	"errors"
+	"syscall"
+
+	"github.com/AdityaNarayan29/masstDB/internal/backup"
+	"github.com/AdityaNarayan29/masstDB/internal/database"
+	"github.com/AdityaNarayan29/masstDB/internal/lock"
+	"github.com/AdityaNarayan29/masstDB/internal/storage"
+)
+
+// Code is a stable identifier for a class of failure, used in JSON output
+// and notifications so that wrappers can react without parsing messages
+type Code string
+
+const (
+	Unknown             Code = "unknown"
+	ToolNotFound        Code = "tool_not_found"
+	AuthFailed          Code = "auth_failed"
+	HostUnreachable     Code = "host_unreachable"
+	DatabaseMissing     Code = "database_missing"
+	DiskFull            Code = "disk_full"
+	StorageUploadFailed Code = "storage_upload_failed"
+	VerificationFailed  Code = "verification_failed"
+	LockHeld            Code = "lock_held"
+	HostNotFound        Code = "host_not_found"
+)
+
+// exitCodes maps failure codes to process exit codes
+var exitCodes = map[Code]int{
+	Unknown:             1,
+	ToolNotFound:        10,
+	AuthFailed:          11,
+	HostUnreachable:     12,
+	DatabaseMissing:     13,
+	DiskFull:            14,
+	StorageUploadFailed: 15,
+	VerificationFailed:  16,
+	LockHeld:            17,
+	HostNotFound:        18,
+}
+
+// ExitCode returns the process exit code for a failure code
+func (c Code) ExitCode() int {
+	if code, ok := exitCodes[c]; ok {
+		return code
+	}
+	return 1
+}
+
+// Classify returns the failure code of an error
+func Classify(err error) Code {
+	var held *lock.HeldError
+
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &held), errors.Is(err, lock.ErrLeaseLost):
+		return LockHeld
+	case errors.Is(err, database.ErrToolNotFound):
+		return ToolNotFound
+	case errors.Is(err, database.ErrAuthFailed):
+		return AuthFailed
+	case errors.Is(err, database.ErrHostNotFound):
+		return HostNotFound
+	case errors.Is(err, database.ErrHostUnreachable):
+		return HostUnreachable
+	case errors.Is(err, database.ErrDatabaseMissing):
+		return DatabaseMissing
+	case errors.Is(err, database.ErrDiskFull), errors.Is(err, syscall.ENOSPC):
+		return DiskFull
+	case errors.Is(err, storage.ErrUploadFailed):
+		return StorageUploadFailed
+	case errors.Is(err, backup.ErrVerificationFailed):
+		return VerificationFailed
+	default:
+		return Unknown
+	}
+}
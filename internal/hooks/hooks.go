@@ -0,0 +1,109 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/AdityaNarayan29/masstDB/internal/config"
+	"github.com/AdityaNarayan29/masstDB/internal/logger"
+)
+
+// Hook phases
+const (
+	PreBackup   = "pre_backup"
+	PostBackup  = "post_backup"
+	PreRestore  = "pre_restore"
+	PostRestore = "post_restore"
+)
+
+// DefaultTimeout bounds a hook that doesn't configure its own timeout
+const DefaultTimeout = 5 * time.Minute
+
+// waitDelay is how long to wait for a killed hook's children to release
+// its output before giving up
+const waitDelay = 5 * time.Second
+
+// Env holds the job context passed to hooks as MASSTDB_* environment variables
+type Env map[string]string
+
+// Run runs the hooks of a phase in order. A failing hook stops the phase
+// and returns an error unless it is configured with fail_on_error: false,
+// in which case the failure is only logged.
+func Run(log *logger.Logger, phase string, hooks []config.HookConfig, env Env) error {
+	for i, hook := range hooks {
+		if hook.Command == "" {
+			continue
+		}
+
+		log.Info("Running %s hook %d/%d...", phase, i+1, len(hooks))
+		err := runHook(log, phase, hook, env)
+		if err == nil {
+			continue
+		}
+
+		if hook.FailOnError != nil && !*hook.FailOnError {
+			log.Warn("%s hook failed (ignored): %v", phase, err)
+			continue
+		}
+		return fmt.Errorf("%s hook failed: %w", phase, err)
+	}
+	return nil
+}
+
+// runHook runs a single hook command through the shell
+func runHook(log *logger.Logger, phase string, hook config.HookConfig, env Env) error {
+	timeout := hook.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	cmd := shellCommand(ctx, hook.Command)
+	killProcessGroup(cmd)
+	cmd.WaitDelay = waitDelay
+	cmd.Env = os.Environ()
+	cmd.Env = append(cmd.Env, "MASSTDB_PHASE="+phase)
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("MASSTDB_%s=%s", k, v))
+	}
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	err := cmd.Run()
+
+	for _, line := range strings.Split(strings.TrimRight(output.String(), "\n"), "\n") {
+		if line != "" {
+			log.Debug("[%s] %s", phase, line)
+		}
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+	if err != nil {
+		if out := strings.TrimSpace(output.String()); out != "" {
+			return fmt.Errorf("%s - %s", err, out)
+		}
+		return err
+	}
+	return nil
+}
+
+// shellCommand runs a command line through the platform shell
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
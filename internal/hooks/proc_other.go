@@ -0,0 +1,9 @@
+//go:build !unix
+
+package hooks
+
+import "os/exec"
+
+// killProcessGroup is a no-op where process groups aren't available; a
+// timed out hook only has its shell killed
+func killProcessGroup(cmd *exec.Cmd) {}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package hooks
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// killProcessGroup makes a timed out hook kill the whole process group,
+// so that children started by the shell don't outlive it
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
@@ -0,0 +1,38 @@
+//go:build !unix
+
+package lock
+
+import (
+	"errors"
+	"os"
+)
+
+// errLocked is returned by tryLockFile when another process holds the lock
+var errLocked = errors.New("lock is held")
+
+// tryLockFile emulates an exclusive lock with a marker file created
+// alongside the lock file. Unlike flock, the marker survives a crash and
+// has to be cleared with "masstdb locks --break".
+func tryLockFile(file *os.File) error {
+	marker, err := os.OpenFile(file.Name()+".held", os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return errLocked
+		}
+		return err
+	}
+	return marker.Close()
+}
+
+// unlockFile removes the marker file
+func unlockFile(file *os.File) error {
+	return os.Remove(file.Name() + ".held")
+}
+
+// clearLockFile removes the marker of a broken lock
+func clearLockFile(path string) error {
+	if err := os.Remove(path + ".held"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,511 @@
+package lock
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AdityaNarayan29/masstDB/internal/database"
+	"github.com/AdityaNarayan29/masstDB/internal/storage"
+)
+
+// lockSuffix is the file extension used for lock files and objects
+const lockSuffix = ".lock"
+
+// pollInterval is how often a waiting Acquire retries the lock
+const pollInterval = time.Second
+
+// Info describes the holder of a lock
+type Info struct {
+	Key        string    `json:"key"`
+	Target     string    `json:"target"`
+	Operation  string    `json:"operation"` // backup, restore
+	Hostname   string    `json:"hostname"`
+	PID        int       `json:"pid"`
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at,omitempty"` // Lease expiry of the remote lock
+}
+
+// Expired returns true if the lease of a remote lock has run out
+func (i Info) Expired() bool {
+	return !i.ExpiresAt.IsZero() && time.Now().After(i.ExpiresAt)
+}
+
+// ErrLeaseLost is returned when the remote lease of a held lock ran out or
+// was taken over by another holder
+var ErrLeaseLost = errors.New("remote lock lease lost")
+
+// HeldError is returned when a lock is held by another process
+type HeldError struct {
+	Holder Info
+}
+
+func (e *HeldError) Error() string {
+	return fmt.Sprintf("%s is locked by %s (pid %d on %s) since %s",
+		e.Holder.Target, e.Holder.Operation, e.Holder.PID, e.Holder.Hostname,
+		e.Holder.AcquiredAt.Local().Format("2006-01-02 15:04:05"))
+}
+
+// Options controls how a lock is acquired
+type Options struct {
+	Wait    bool          // Block until the lock is free instead of failing
+	Timeout time.Duration // Maximum time to wait (0 waits forever)
+}
+
+// Manager hands out per-target locks. Every lock is a local flock in Dir;
+// when Remote is set, a lease object is also kept in remote storage so
+// that runs on different machines exclude each other.
+type Manager struct {
+	Dir    string
+	Remote string        // Optional storage prefix (s3://, gs://, sftp:// or a shared path)
+	Lease  time.Duration // Lifetime of the remote lock between renewals
+
+	// Warn, if set, is called when renewing a remote lease fails
+	Warn func(format string, args ...any)
+}
+
+// DefaultDir returns the default local lock directory
+func DefaultDir() string {
+	return filepath.Join(os.TempDir(), "masstdb-locks")
+}
+
+// DefaultLease is the default lifetime of a remote lock
+const DefaultLease = 5 * time.Minute
+
+// NewManager creates a lock manager
+func NewManager(dir, remote string) *Manager {
+	if dir == "" {
+		dir = DefaultDir()
+	}
+	return &Manager{Dir: dir, Remote: remote, Lease: DefaultLease}
+}
+
+// Target returns a human readable description of a database target
+func Target(config database.Config) string {
+	if config.Type == "sqlite" {
+		path, err := filepath.Abs(config.Database)
+		if err != nil {
+			path = config.Database
+		}
+		return fmt.Sprintf("sqlite:%s", path)
+	}
+	// SRV names and replica set seed lists carry no single port
+	if config.SRV || strings.Contains(config.Host, ",") {
+		return fmt.Sprintf("%s://%s/%s", config.Type, config.Host, config.Database)
+	}
+	return fmt.Sprintf("%s://%s:%d/%s", config.Type, config.Host, config.Port, config.Database)
+}
+
+// Key returns the lock key for a database target (engine+host+port+db)
+func Key(config database.Config) string {
+	target := Target(config)
+	sum := sha256.Sum256([]byte(target))
+
+	name := fmt.Sprintf("%s_%s_%d_%s", config.Type, config.Host, config.Port, config.Database)
+	if config.Type == "sqlite" {
+		name = fmt.Sprintf("sqlite_%s", filepath.Base(config.Database))
+	}
+
+	name = strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '.' {
+			return r
+		}
+		return '_'
+	}, name)
+
+	return fmt.Sprintf("%s_%s", name, hex.EncodeToString(sum[:4]))
+}
+
+// Lock is an acquired target lock
+type Lock struct {
+	manager *Manager
+	file    *os.File
+
+	mu   sync.Mutex
+	info Info
+	err  error // Why the remote lease was lost, set by renew
+
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// Acquire takes the lock for a database target
+func (m *Manager) Acquire(config database.Config, operation string, opts Options) (*Lock, error) {
+	hostname, _ := os.Hostname()
+	info := Info{
+		Key:       Key(config),
+		Target:    Target(config),
+		Operation: operation,
+		Hostname:  hostname,
+		PID:       os.Getpid(),
+	}
+
+	var deadline time.Time
+	if opts.Timeout > 0 {
+		deadline = time.Now().Add(opts.Timeout)
+	}
+
+	for {
+		lock, err := m.tryAcquire(info)
+		if err == nil {
+			return lock, nil
+		}
+
+		var held *HeldError
+		if !errors.As(err, &held) || !opts.Wait {
+			return nil, err
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock: %w", err)
+		}
+
+		time.Sleep(pollInterval)
+	}
+}
+
+// tryAcquire makes a single non-blocking attempt to take the lock
+func (m *Manager) tryAcquire(info Info) (*Lock, error) {
+	if err := os.MkdirAll(m.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create lock directory: %w", err)
+	}
+
+	path := m.localPath(info.Key)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	if err := tryLockFile(file); err != nil {
+		file.Close()
+		if errors.Is(err, errLocked) {
+			holder, readErr := readInfo(path)
+			if readErr != nil {
+				holder = Info{Key: info.Key, Target: info.Target, Operation: "unknown"}
+			}
+			return nil, &HeldError{Holder: holder}
+		}
+		return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+	}
+
+	info.AcquiredAt = time.Now().UTC()
+	lock := &Lock{manager: m, info: info, file: file}
+
+	if m.Remote != "" {
+		if err := m.acquireRemote(&lock.info); err != nil {
+			unlockFile(file)
+			file.Close()
+			return nil, err
+		}
+	}
+
+	if err := writeInfo(file, lock.info); err != nil {
+		lock.Release()
+		return nil, err
+	}
+
+	if m.Remote != "" {
+		lock.stop = make(chan struct{})
+		lock.done.Add(1)
+		go lock.renew()
+	}
+
+	return lock, nil
+}
+
+// acquireRemote takes the remote lease unless another live holder has it
+func (m *Manager) acquireRemote(info *Info) error {
+	location := m.remotePath(info.Key)
+
+	data, err := storage.ReadFile(location)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read remote lock: %w", err)
+	}
+	if err == nil {
+		var holder Info
+		if json.Unmarshal(data, &holder) == nil && !holder.Expired() && !isSelf(holder, *info) {
+			return &HeldError{Holder: holder}
+		}
+	}
+
+	info.ExpiresAt = time.Now().UTC().Add(m.Lease)
+	if err := writeRemote(location, *info); err != nil {
+		return err
+	}
+
+	// Storage has no compare-and-swap, so re-read to detect a racing writer
+	data, err = storage.ReadFile(location)
+	if err != nil {
+		return fmt.Errorf("failed to verify remote lock: %w", err)
+	}
+	var holder Info
+	if err := json.Unmarshal(data, &holder); err != nil {
+		return fmt.Errorf("failed to parse remote lock: %w", err)
+	}
+	if !isSelf(holder, *info) {
+		return &HeldError{Holder: holder}
+	}
+
+	return nil
+}
+
+// renew extends the remote lease until the lock is released. Failed
+// renewals are retried on the next tick until the lease runs out; a lease
+// that ran out or was taken over by another holder is lost for good.
+func (l *Lock) renew() {
+	defer l.done.Done()
+
+	ticker := time.NewTicker(l.manager.Lease / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			err := l.renewOnce()
+			if err == nil {
+				continue
+			}
+
+			info := l.Info()
+			var held *HeldError
+			if errors.As(err, &held) || info.Expired() {
+				err = fmt.Errorf("%w: %s: %w", ErrLeaseLost, info.Key, err)
+				l.mu.Lock()
+				l.err = err
+				l.mu.Unlock()
+				l.warn("%v", err)
+				return
+			}
+			l.warn("Failed to renew remote lock %s: %v", info.Key, err)
+		}
+	}
+}
+
+// renewOnce checks that the remote lease is still ours and extends it
+func (l *Lock) renewOnce() error {
+	info := l.Info()
+	location := l.manager.remotePath(info.Key)
+
+	data, err := storage.ReadFile(location)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to read remote lock: %w", err)
+	}
+	if err == nil {
+		var holder Info
+		if json.Unmarshal(data, &holder) == nil && !isSelf(holder, info) {
+			return &HeldError{Holder: holder}
+		}
+	}
+
+	info.ExpiresAt = time.Now().UTC().Add(l.manager.Lease)
+	if err := writeRemote(location, info); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.info.ExpiresAt = info.ExpiresAt
+	l.mu.Unlock()
+	return nil
+}
+
+// warn reports a renewal problem through the manager's Warn function
+func (l *Lock) warn(format string, args ...any) {
+	if l.manager.Warn != nil {
+		l.manager.Warn(format, args...)
+	}
+}
+
+// Info returns information about the lock holder
+func (l *Lock) Info() Info {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.info
+}
+
+// Err returns why the remote lease was lost while the lock was held, or
+// nil. Another process may have taken the lock since.
+func (l *Lock) Err() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.err
+}
+
+// Release releases the lock
+func (l *Lock) Release() error {
+	if l.stop != nil {
+		close(l.stop)
+		l.done.Wait()
+		l.stop = nil
+	}
+
+	// A lost lease may belong to another holder by now
+	var firstErr error
+	if l.manager.Remote != "" && l.Err() == nil {
+		if err := storage.Remove(l.manager.remotePath(l.info.Key)); err != nil {
+			firstErr = fmt.Errorf("failed to remove remote lock: %w", err)
+		}
+	}
+
+	// The lock file itself is kept; removing a file another process may
+	// already have opened would let two processes lock different inodes.
+	l.file.Truncate(0)
+	if err := unlockFile(l.file); err != nil && firstErr == nil {
+		firstErr = fmt.Errorf("failed to unlock: %w", err)
+	}
+	l.file.Close()
+
+	return firstErr
+}
+
+// Status describes a lock found by List
+type Status struct {
+	Info
+	Held   bool // A process currently holds the local lock
+	Remote bool // The lock was found in remote storage
+}
+
+// List returns the locks known to the manager, local and remote
+func (m *Manager) List() ([]Status, error) {
+	var locks []Status
+
+	entries, err := os.ReadDir(m.Dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read lock directory: %w", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), lockSuffix) {
+			continue
+		}
+
+		key := strings.TrimSuffix(entry.Name(), lockSuffix)
+		info, err := readInfo(m.localPath(key))
+		if err != nil {
+			// Released locks are truncated; nothing to report
+			continue
+		}
+		locks = append(locks, Status{Info: info, Held: m.isHeld(key)})
+	}
+
+	if m.Remote != "" {
+		names, err := storage.List(m.Remote)
+		if err != nil {
+			return locks, fmt.Errorf("failed to list remote locks: %w", err)
+		}
+		for _, name := range names {
+			if !strings.HasSuffix(name, lockSuffix) {
+				continue
+			}
+			data, err := storage.ReadFile(storage.Join(m.Remote, name))
+			if err != nil {
+				continue
+			}
+			var info Info
+			if json.Unmarshal(data, &info) != nil {
+				continue
+			}
+			locks = append(locks, Status{Info: info, Held: !info.Expired(), Remote: true})
+		}
+	}
+
+	return locks, nil
+}
+
+// Break forcibly clears a lock: its record, its remote lease and, where
+// locks are emulated with marker files, its marker. A local lock that is
+// still held by a running process is only cleared when force is set.
+func (m *Manager) Break(key string, force bool) error {
+	if m.isHeld(key) && !force {
+		info, _ := readInfo(m.localPath(key))
+		return &HeldError{Holder: info}
+	}
+
+	// Like Release, keep the lock file itself so that every process keeps
+	// locking the same inode
+	if err := os.Truncate(m.localPath(key), 0); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to clear lock file: %w", err)
+	}
+	if err := clearLockFile(m.localPath(key)); err != nil {
+		return fmt.Errorf("failed to remove lock file: %w", err)
+	}
+
+	if m.Remote != "" {
+		if err := storage.Remove(m.remotePath(key)); err != nil {
+			return fmt.Errorf("failed to remove remote lock: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// isHeld checks whether a process holds the local lock for key
+func (m *Manager) isHeld(key string) bool {
+	file, err := os.OpenFile(m.localPath(key), os.O_RDWR, 0644)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	if err := tryLockFile(file); err != nil {
+		return errors.Is(err, errLocked)
+	}
+	unlockFile(file)
+	return false
+}
+
+func (m *Manager) localPath(key string) string {
+	return filepath.Join(m.Dir, key+lockSuffix)
+}
+
+func (m *Manager) remotePath(key string) string {
+	return storage.Join(m.Remote, key+lockSuffix)
+}
+
+// isSelf reports whether a lock record belongs to this process
+func isSelf(holder, self Info) bool {
+	return holder.Hostname == self.Hostname && holder.PID == self.PID
+}
+
+func readInfo(path string) (Info, error) {
+	var info Info
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return info, err
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return info, err
+	}
+	return info, nil
+}
+
+func writeInfo(file *os.File, info Info) error {
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal lock info: %w", err)
+	}
+	if err := file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+	if _, err := file.WriteAt(append(data, '\n'), 0); err != nil {
+		return fmt.Errorf("failed to write lock file: %w", err)
+	}
+	return nil
+}
+
+func writeRemote(location string, info Info) error {
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal lock info: %w", err)
+	}
+	if err := storage.WriteFile(location, append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write remote lock: %w", err)
+	}
+	return nil
+}
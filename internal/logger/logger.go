@@ -1,9 +1,13 @@
 package logger
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -17,33 +21,132 @@ const (
 	LevelError
 )
 
+// ParseLevel parses a level name (debug, info, warn, error)
+func ParseLevel(name string) (Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return LevelDebug, nil
+	case "info", "":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	default:
+		return LevelInfo, fmt.Errorf("unknown log level: %s", name)
+	}
+}
+
+func (l Level) slogLevel() slog.Level {
+	switch l {
+	case LevelDebug:
+		return slog.LevelDebug
+	case LevelWarn:
+		return slog.LevelWarn
+	case LevelError:
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Options configures a logger
+type Options struct {
+	Level  Level
+	Format string    // text or json
+	Output io.Writer // Console output (default stdout)
+
+	// Optional log file, rotated when it grows past MaxSize bytes
+	File       string
+	MaxSize    int64
+	MaxBackups int
+}
+
 // Logger provides structured logging
 type Logger struct {
-	verbose bool
-	output  io.Writer
+	slog *slog.Logger
+	sink *sink
+}
+
+// sink is the destination shared by a logger and its derived loggers
+type sink struct {
+	mu      sync.Mutex
+	console io.Writer
+	file    *rotatingFile
+}
+
+func (s *sink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, err := s.console.Write(p)
+	if s.file != nil {
+		if _, ferr := s.file.Write(p); ferr != nil && err == nil {
+			err = ferr
+		}
+	}
+	return n, err
 }
 
 // New creates a new logger
 func New(verbose bool) *Logger {
-	return &Logger{
-		verbose: verbose,
-		output:  os.Stdout,
-	}
+	return NewWithWriter(verbose, os.Stdout)
 }
 
 // NewWithWriter creates a logger with a custom writer
 func NewWithWriter(verbose bool, w io.Writer) *Logger {
-	return &Logger{
-		verbose: verbose,
-		output:  w,
+	level := LevelInfo
+	if verbose {
+		level = LevelDebug
 	}
+	log, _ := NewWithOptions(Options{Level: level, Output: w})
+	return log
 }
 
-// Debug logs a debug message (only if verbose is enabled)
-func (l *Logger) Debug(format string, args ...interface{}) {
-	if l.verbose {
-		l.log(LevelDebug, format, args...)
+// NewWithOptions creates a logger from options
+func NewWithOptions(opts Options) (*Logger, error) {
+	if opts.Output == nil {
+		opts.Output = os.Stdout
 	}
+
+	s := &sink{console: opts.Output}
+	if opts.File != "" {
+		file, err := openRotatingFile(opts.File, opts.MaxSize, opts.MaxBackups)
+		if err != nil {
+			return nil, err
+		}
+		s.file = file
+	}
+
+	handlerOpts := &slog.HandlerOptions{Level: opts.Level.slogLevel()}
+
+	var handler slog.Handler
+	switch opts.Format {
+	case FormatJSON:
+		handler = slog.NewJSONHandler(s, handlerOpts)
+	case FormatText, "":
+		handler = &textHandler{w: s, level: handlerOpts.Level}
+	default:
+		return nil, fmt.Errorf("unknown log format: %s", opts.Format)
+	}
+
+	return &Logger{slog: slog.New(handler), sink: s}, nil
+}
+
+// With returns a logger that adds the given key/value fields to every message
+func (l *Logger) With(args ...any) *Logger {
+	return &Logger{slog: l.slog.With(args...), sink: l.sink}
+}
+
+// Debug logs a debug message (only if the debug level is enabled)
+func (l *Logger) Debug(format string, args ...interface{}) {
+	l.log(LevelDebug, format, args...)
 }
 
 // Info logs an info message
@@ -62,29 +165,91 @@ func (l *Logger) Error(format string, args ...interface{}) {
 }
 
 func (l *Logger) log(level Level, format string, args ...interface{}) {
-	timestamp := time.Now().Format("15:04:05")
-	prefix := l.levelPrefix(level)
+	ctx := context.Background()
+	if !l.slog.Enabled(ctx, level.slogLevel()) {
+		return
+	}
+	l.slog.Log(ctx, level.slogLevel(), fmt.Sprintf(format, args...))
+}
 
-	message := fmt.Sprintf(format, args...)
-	fmt.Fprintf(l.output, "%s %s %s\n", timestamp, prefix, message)
+// SetOutput sets the console output writer
+func (l *Logger) SetOutput(w io.Writer) {
+	l.sink.mu.Lock()
+	defer l.sink.mu.Unlock()
+	l.sink.console = w
 }
 
-func (l *Logger) levelPrefix(level Level) string {
-	switch level {
-	case LevelDebug:
+// Close closes the log file, if any
+func (l *Logger) Close() error {
+	l.sink.mu.Lock()
+	defer l.sink.mu.Unlock()
+	if l.sink.file == nil {
+		return nil
+	}
+	return l.sink.file.Close()
+}
+
+// textHandler formats records as "<RFC3339 time> [LEVEL] message key=value ..."
+type textHandler struct {
+	w     io.Writer
+	level slog.Leveler
+	attrs []slog.Attr
+}
+
+func (h *textHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= h.level.Level()
+}
+
+func (h *textHandler) Handle(_ context.Context, r slog.Record) error {
+	var b strings.Builder
+	b.WriteString(r.Time.Format(time.RFC3339))
+	b.WriteByte(' ')
+	b.WriteString(levelPrefix(r.Level))
+	b.WriteByte(' ')
+	b.WriteString(r.Message)
+
+	for _, attr := range h.attrs {
+		writeAttr(&b, attr)
+	}
+	r.Attrs(func(attr slog.Attr) bool {
+		writeAttr(&b, attr)
+		return true
+	})
+
+	b.WriteByte('\n')
+	_, err := io.WriteString(h.w, b.String())
+	return err
+}
+
+func (h *textHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	combined := make([]slog.Attr, 0, len(h.attrs)+len(attrs))
+	combined = append(combined, h.attrs...)
+	combined = append(combined, attrs...)
+	return &textHandler{w: h.w, level: h.level, attrs: combined}
+}
+
+func (h *textHandler) WithGroup(name string) slog.Handler {
+	// Groups aren't used by this tool; fields are kept flat
+	return h
+}
+
+func writeAttr(b *strings.Builder, attr slog.Attr) {
+	value := attr.Value.Resolve().String()
+	if strings.ContainsAny(value, " \t\n\"=") {
+		value = fmt.Sprintf("%q", value)
+	}
+	fmt.Fprintf(b, " %s=%s", attr.Key, value)
+}
+
+func levelPrefix(level slog.Level) string {
+	switch {
+	case level < slog.LevelInfo:
 		return "[DEBUG]"
-	case LevelInfo:
+	case level < slog.LevelWarn:
 		return "[INFO] "
-	case LevelWarn:
+	case level < slog.LevelError:
 		return "[WARN] "
-	case LevelError:
-		return "[ERROR]"
 	default:
-		return "[???]  "
+		return "[ERROR]"
 	}
 }
-
-// SetOutput sets the output writer
-func (l *Logger) SetOutput(w io.Writer) {
-	l.output = w
-}
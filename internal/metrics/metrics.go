@@ -0,0 +1,237 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Metric names exported for backup jobs. There is no retention deletions
+// counter, as old artifacts aren't pruned.
+const (
+	LastSuccess   = "masstdb_backup_last_success_timestamp_seconds"
+	LastDuration  = "masstdb_backup_last_duration_seconds"
+	LastSize      = "masstdb_backup_last_size_bytes"
+	Failures      = "masstdb_backup_failures_total"
+	Successes     = "masstdb_backup_success_total"
+	BytesWritten  = "masstdb_backup_bytes_written_total"
+	LastRunStatus = "masstdb_backup_last_run_success"
+)
+
+// definition holds the HELP and TYPE metadata of a metric
+type definition struct {
+	help string
+	kind string // gauge or counter
+}
+
+var definitions = map[string]definition{
+	LastSuccess:   {"Unix time of the last successful backup.", "gauge"},
+	LastDuration:  {"Duration of the last backup in seconds.", "gauge"},
+	LastSize:      {"Size of the last successful backup artifact in bytes.", "gauge"},
+	Failures:      {"Number of failed backups.", "counter"},
+	Successes:     {"Number of successful backups.", "counter"},
+	BytesWritten:  {"Bytes written per backup destination.", "counter"},
+	LastRunStatus: {"Whether the last backup succeeded (1) or failed (0).", "gauge"},
+}
+
+// Run describes the outcome of a single backup run
+type Run struct {
+	Job         string
+	Target      string // Database target, e.g. postgres://host:5432/db
+	Destination string // Output directory or stream the artifact was written to
+	Success     bool
+	Duration    time.Duration
+	Size        int64
+	Finished    time.Time
+}
+
+// Registry holds metric samples in memory
+type Registry struct {
+	mu     sync.Mutex
+	series map[string]*sample
+}
+
+type sample struct {
+	name   string
+	labels string // Rendered label set, e.g. {job="a",target="b"}
+	value  float64
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{series: make(map[string]*sample)}
+}
+
+// RecordBackup updates the job and target metrics for a completed run
+func (r *Registry) RecordBackup(run Run) {
+	labels := formatLabels("job", run.Job, "target", run.Target)
+
+	r.set(LastDuration, labels, run.Duration.Seconds())
+
+	if !run.Success {
+		r.add(Failures, labels, 1)
+		r.set(LastRunStatus, labels, 0)
+		return
+	}
+
+	r.add(Successes, labels, 1)
+	r.set(LastRunStatus, labels, 1)
+	r.set(LastSuccess, labels, float64(run.Finished.Unix()))
+	r.set(LastSize, labels, float64(run.Size))
+	r.add(BytesWritten, formatLabels("job", run.Job, "target", run.Target, "destination", run.Destination), float64(run.Size))
+}
+
+func (r *Registry) set(name, labels string, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sample(name, labels).value = value
+}
+
+func (r *Registry) add(name, labels string, value float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sample(name, labels).value += value
+}
+
+// sample returns the sample for a series, creating it if needed.
+// The caller must hold r.mu.
+func (r *Registry) sample(name, labels string) *sample {
+	key := name + labels
+	s, ok := r.series[key]
+	if !ok {
+		s = &sample{name: name, labels: labels}
+		r.series[key] = s
+	}
+	return s
+}
+
+// WriteText writes all samples in the Prometheus text exposition format
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	samples := make([]sample, 0, len(r.series))
+	for _, s := range r.series {
+		samples = append(samples, *s)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].name != samples[j].name {
+			return samples[i].name < samples[j].name
+		}
+		return samples[i].labels < samples[j].labels
+	})
+
+	bw := bufio.NewWriter(w)
+	for i, s := range samples {
+		if i == 0 || samples[i-1].name != s.name {
+			def := definitions[s.name]
+			fmt.Fprintf(bw, "# HELP %s %s\n", s.name, def.help)
+			fmt.Fprintf(bw, "# TYPE %s %s\n", s.name, def.kind)
+		}
+		fmt.Fprintf(bw, "%s%s %s\n", s.name, s.labels, strconv.FormatFloat(s.value, 'f', -1, 64))
+	}
+	return bw.Flush()
+}
+
+// Handler serves the registry at a /metrics endpoint
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+// LoadTextfile seeds the registry from a textfile written by WriteTextfile,
+// so that one-shot runs keep counters and last-success timestamps across
+// invocations. A missing file is not an error.
+func (r *Registry) LoadTextfile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open metrics file: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		sep := strings.LastIndexByte(line, ' ')
+		if sep < 0 {
+			continue
+		}
+		value, err := strconv.ParseFloat(line[sep+1:], 64)
+		if err != nil {
+			continue
+		}
+
+		series := line[:sep]
+		name, labels := series, ""
+		if i := strings.IndexByte(series, '{'); i >= 0 {
+			name, labels = series[:i], series[i:]
+		}
+		if _, ok := definitions[name]; !ok {
+			continue
+		}
+
+		r.set(name, labels, value)
+	}
+
+	return scanner.Err()
+}
+
+// WriteTextfile atomically writes the registry to a node_exporter
+// textfile-collector file
+func (r *Registry) WriteTextfile(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create metrics file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := r.WriteText(tmp); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	return nil
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// formatLabels renders label name/value pairs in exposition format
+func formatLabels(pairs ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", pairs[i], labelEscaper.Replace(pairs[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
@@ -0,0 +1,278 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/AdityaNarayan29/masstDB/internal/backup"
+	"github.com/AdityaNarayan29/masstDB/internal/config"
+	"github.com/AdityaNarayan29/masstDB/internal/logger"
+)
+
+// Event statuses
+const (
+	StatusSuccess = "success"
+	StatusFailure = "failure"
+	StatusShrink  = "shrink" // Backup is much smaller than the previous one
+)
+
+// DefaultShrinkThreshold flags backups smaller than this fraction of the previous one
+const DefaultShrinkThreshold = 0.5
+
+// requestTimeout bounds each notification request
+const requestTimeout = 30 * time.Second
+
+// Event describes a backup outcome
+type Event struct {
+	Job          string           `json:"job"`
+	Target       string           `json:"target"`
+	Status       string           `json:"status"`
+	Message      string           `json:"message"`
+	Error        string           `json:"error,omitempty"`
+	ErrorCode    string           `json:"error_code,omitempty"`
+	Manifest     *backup.Manifest `json:"manifest,omitempty"`
+	PreviousSize int64            `json:"previous_size,omitempty"`
+	Time         time.Time        `json:"time"`
+}
+
+// Notifier delivers events to an external system
+type Notifier interface {
+	Notify(event Event) error
+}
+
+// Target is a notifier together with the statuses it is subscribed to
+type Target struct {
+	Name     string
+	Notifier Notifier
+	On       map[string]bool
+}
+
+// FromConfig builds notification targets from job configuration
+func FromConfig(configs []config.NotifyConfig) ([]Target, error) {
+	var targets []Target
+	for _, c := range configs {
+		var n Notifier
+		switch c.Type {
+		case "webhook":
+			if c.URL == "" {
+				return nil, fmt.Errorf("webhook notifier requires url")
+			}
+			n = &Webhook{URL: c.URL, Headers: c.Headers, CAFile: c.CAFile}
+		case "slack":
+			if c.URL == "" {
+				return nil, fmt.Errorf("slack notifier requires url")
+			}
+			n = &Slack{URL: c.URL, CAFile: c.CAFile}
+		case "email":
+			if c.SMTPHost == "" || c.From == "" || len(c.To) == 0 {
+				return nil, fmt.Errorf("email notifier requires smtp_host, from and to")
+			}
+			port := c.SMTPPort
+			if port == 0 {
+				port = 25
+			}
+			n = &Email{
+				Host:     c.SMTPHost,
+				Port:     port,
+				Username: c.Username,
+				Password: c.Password,
+				From:     c.From,
+				To:       c.To,
+			}
+		default:
+			return nil, fmt.Errorf("unsupported notifier type: %s", c.Type)
+		}
+
+		on := map[string]bool{}
+		statuses := c.On
+		if len(statuses) == 0 {
+			statuses = []string{StatusFailure, StatusShrink}
+		}
+		for _, status := range statuses {
+			switch status {
+			case StatusSuccess, StatusFailure, StatusShrink:
+				on[status] = true
+			default:
+				return nil, fmt.Errorf("unsupported notification event: %s", status)
+			}
+		}
+
+		targets = append(targets, Target{Name: c.Type, Notifier: n, On: on})
+	}
+	return targets, nil
+}
+
+// Send delivers an event to every target subscribed to its status.
+// Delivery failures are logged and never fail the job.
+func Send(log *logger.Logger, targets []Target, event Event) {
+	for _, t := range targets {
+		if !t.On[event.Status] {
+			continue
+		}
+		if err := t.Notifier.Notify(event); err != nil {
+			log.Warn("Failed to send %s notification: %v", t.Name, err)
+			continue
+		}
+		log.Debug("Sent %s notification for %s", t.Name, event.Status)
+	}
+}
+
+// Webhook posts the event as JSON to a URL
+type Webhook struct {
+	URL     string
+	Headers map[string]string
+	CAFile  string // Extra CA certificates to verify the server with
+}
+
+// Notify posts the event
+func (w *Webhook) Notify(event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	return postJSON(w.URL, body, w.Headers, w.CAFile)
+}
+
+// Slack posts a message to a Slack-compatible incoming webhook
+type Slack struct {
+	URL    string
+	CAFile string // Extra CA certificates to verify the server with
+}
+
+// Notify posts the event as a chat message
+func (s *Slack) Notify(event Event) error {
+	body, err := json.Marshal(map[string]string{"text": formatText(event)})
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return postJSON(s.URL, body, nil, s.CAFile)
+}
+
+// Email sends the event as a plain text email over SMTP
+type Email struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// Notify sends the email
+func (e *Email) Notify(event Event) error {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", e.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject(event))
+	fmt.Fprintf(&msg, "Date: %s\r\n", event.Time.Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(formatText(event), "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	var auth smtp.Auth
+	if e.Username != "" {
+		auth = smtp.PlainAuth("", e.Username, e.Password, e.Host)
+	}
+
+	addr := fmt.Sprintf("%s:%d", e.Host, e.Port)
+	if err := smtp.SendMail(addr, auth, e.From, e.To, []byte(msg.String())); err != nil {
+		return fmt.Errorf("failed to send email: %w", err)
+	}
+	return nil
+}
+
+func postJSON(url string, body []byte, headers map[string]string, caFile string) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	client, err := httpClient(caFile)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("request failed: %s", resp.Status)
+	}
+	return nil
+}
+
+// httpClient returns a client trusting the system CAs and, if caFile is
+// set, the CA certificates in it
+func httpClient(caFile string) (*http.Client, error) {
+	client := &http.Client{Timeout: requestTimeout}
+	if caFile == "" {
+		return client, nil
+	}
+
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in CA file %s", caFile)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	client.Transport = transport
+	return client, nil
+}
+
+// subject returns a one-line summary of the event
+func subject(event Event) string {
+	switch event.Status {
+	case StatusFailure:
+		return fmt.Sprintf("[masstdb] Backup FAILED: %s (%s)", event.Job, event.Target)
+	case StatusShrink:
+		return fmt.Sprintf("[masstdb] Backup smaller than expected: %s (%s)", event.Job, event.Target)
+	default:
+		return fmt.Sprintf("[masstdb] Backup succeeded: %s (%s)", event.Job, event.Target)
+	}
+}
+
+// formatText renders the event for humans
+func formatText(event Event) string {
+	var b strings.Builder
+	b.WriteString(subject(event))
+	b.WriteString("\n")
+	if event.Message != "" {
+		fmt.Fprintf(&b, "\n%s\n", event.Message)
+	}
+	if m := event.Manifest; m != nil {
+		fmt.Fprintf(&b, "\nFile: %s\nSize: %d bytes\nChecksum: %s\nCreated: %s\nDuration: %s\n",
+			m.File, m.Size, m.Checksum, m.CreatedAt.Format(time.RFC3339), m.Duration)
+		if len(m.Diagnostics) > 0 {
+			fmt.Fprintf(&b, "\nTool output:\n%s\n", strings.Join(m.Diagnostics, "\n"))
+		}
+	}
+	if event.PreviousSize > 0 {
+		fmt.Fprintf(&b, "Previous size: %d bytes\n", event.PreviousSize)
+	}
+	if event.Error != "" {
+		fmt.Fprintf(&b, "\nError:\n%s\n", event.Error)
+	}
+	return b.String()
+}
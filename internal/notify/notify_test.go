@@ -0,0 +1,270 @@
+package notify
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AdityaNarayan29/masstDB/internal/backup"
+)
+
+// testEvent returns a success event with a manifest and tool warnings
+func testEvent() Event {
+	return Event{
+		Job:     "nightly",
+		Target:  "postgres://db:5432/app",
+		Status:  StatusSuccess,
+		Message: "Backup completed successfully",
+		Manifest: &backup.Manifest{
+			ID:          "app_full_20260130_152700",
+			File:        "app_full_20260130_152700.sql.gz",
+			Database:    "app",
+			Size:        4096,
+			Checksum:    "sha256:abc123",
+			CreatedAt:   time.Date(2026, 1, 30, 15, 27, 0, 0, time.UTC),
+			Duration:    "1.5s",
+			Diagnostics: []string{"pg_dump: warning: there are circular foreign-key constraints"},
+		},
+		Time: time.Date(2026, 1, 30, 15, 27, 2, 0, time.UTC),
+	}
+}
+
+// failureEvent returns a failure event carrying native tool stderr
+func failureEvent() Event {
+	return Event{
+		Job:       "nightly",
+		Target:    "postgres://db:5432/app",
+		Status:    StatusFailure,
+		Message:   "Backup failed",
+		Error:     "pg_dump failed: exit status 1 - pg_dump: error: connection refused",
+		ErrorCode: "connection_refused",
+		Time:      time.Date(2026, 1, 30, 15, 27, 2, 0, time.UTC),
+	}
+}
+
+// httpStub records the requests posted to it
+func httpStub(t *testing.T, status int) (*httptest.Server, <-chan *http.Request, <-chan []byte) {
+	t.Helper()
+	requests := make(chan *http.Request, 4)
+	bodies := make(chan []byte, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests <- r
+		bodies <- body
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests, bodies
+}
+
+func TestWebhook(t *testing.T) {
+	server, requests, bodies := httpStub(t, http.StatusOK)
+
+	webhook := &Webhook{URL: server.URL, Headers: map[string]string{"Authorization": "Bearer token"}}
+	if err := webhook.Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	r := <-requests
+	if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("got %s with Content-Type %q, want a JSON POST", r.Method, r.Header.Get("Content-Type"))
+	}
+	if got := r.Header.Get("Authorization"); got != "Bearer token" {
+		t.Errorf("Authorization header = %q, want %q", got, "Bearer token")
+	}
+
+	var event Event
+	if err := json.Unmarshal(<-bodies, &event); err != nil {
+		t.Fatalf("payload is not an event: %v", err)
+	}
+	if event.Status != StatusSuccess || event.Job != "nightly" {
+		t.Errorf("got status %q for job %q", event.Status, event.Job)
+	}
+	m := event.Manifest
+	if m == nil {
+		t.Fatal("payload has no manifest")
+	}
+	if m.File != "app_full_20260130_152700.sql.gz" || m.Size != 4096 || m.Checksum != "sha256:abc123" {
+		t.Errorf("manifest fields not carried: %+v", m)
+	}
+	if len(m.Diagnostics) != 1 || !strings.Contains(m.Diagnostics[0], "circular foreign-key") {
+		t.Errorf("manifest diagnostics not carried: %q", m.Diagnostics)
+	}
+}
+
+func TestWebhookFailure(t *testing.T) {
+	server, _, bodies := httpStub(t, http.StatusOK)
+
+	if err := (&Webhook{URL: server.URL}).Notify(failureEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	var event Event
+	if err := json.Unmarshal(<-bodies, &event); err != nil {
+		t.Fatalf("payload is not an event: %v", err)
+	}
+	if !strings.Contains(event.Error, "pg_dump: error: connection refused") || event.ErrorCode != "connection_refused" {
+		t.Errorf("stderr not carried: error %q, code %q", event.Error, event.ErrorCode)
+	}
+}
+
+func TestWebhookErrorStatus(t *testing.T) {
+	server, _, _ := httpStub(t, http.StatusInternalServerError)
+
+	err := (&Webhook{URL: server.URL}).Notify(testEvent())
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("Notify = %v, want a 500 error", err)
+	}
+}
+
+func TestWebhookCAFile(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	t.Cleanup(server.Close)
+
+	// The test server's certificate is self-signed
+	err := (&Webhook{URL: server.URL}).Notify(testEvent())
+	var unknownAuthority x509.UnknownAuthorityError
+	if !errors.As(err, &unknownAuthority) {
+		t.Errorf("Notify without CA file = %v, want an unknown authority error", err)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	block := &pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("write CA file: %v", err)
+	}
+	if err := (&Webhook{URL: server.URL, CAFile: caFile}).Notify(testEvent()); err != nil {
+		t.Errorf("Notify with CA file: %v", err)
+	}
+}
+
+func TestSlack(t *testing.T) {
+	server, _, bodies := httpStub(t, http.StatusOK)
+
+	slack := &Slack{URL: server.URL}
+	if err := slack.Notify(testEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+	if err := slack.Notify(failureEvent()); err != nil {
+		t.Fatalf("Notify: %v", err)
+	}
+
+	for _, want := range [][]string{
+		{"Backup succeeded: nightly", "app_full_20260130_152700.sql.gz", "sha256:abc123", "circular foreign-key"},
+		{"Backup FAILED: nightly", "pg_dump: error: connection refused"},
+	} {
+		var message map[string]string
+		if err := json.Unmarshal(<-bodies, &message); err != nil {
+			t.Fatalf("payload is not a message: %v", err)
+		}
+		for _, s := range want {
+			if !strings.Contains(message["text"], s) {
+				t.Errorf("message text %q does not contain %q", message["text"], s)
+			}
+		}
+	}
+}
+
+// smtpStub accepts one email and returns its envelope and data
+func smtpStub(t *testing.T) (host string, port int, mail <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var transcript strings.Builder
+		r := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+		reply("220 localhost ESMTP stub")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(command, "MAIL FROM"), strings.HasPrefix(command, "RCPT TO"):
+				transcript.WriteString(strings.TrimSpace(line) + "\n")
+				reply("250 OK")
+			case command == "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					transcript.WriteString(line)
+				}
+				reply("250 OK")
+			case command == "QUIT":
+				reply("221 Bye")
+				received <- transcript.String()
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port, received
+}
+
+func TestEmail(t *testing.T) {
+	for _, event := range []Event{testEvent(), failureEvent()} {
+		host, port, mail := smtpStub(t)
+
+		email := &Email{Host: host, Port: port, From: "masstdb@example.com", To: []string{"ops@example.com"}}
+		if err := email.Notify(event); err != nil {
+			t.Fatalf("Notify: %v", err)
+		}
+
+		var msg string
+		select {
+		case msg = <-mail:
+		case <-time.After(5 * time.Second):
+			t.Fatal("no email received")
+		}
+
+		want := []string{"MAIL FROM:<masstdb@example.com>", "RCPT TO:<ops@example.com>", "Subject: " + subject(event)}
+		if event.Status == StatusSuccess {
+			want = append(want, "app_full_20260130_152700.sql.gz", "sha256:abc123", "circular foreign-key")
+		} else {
+			want = append(want, "pg_dump: error: connection refused")
+		}
+		for _, s := range want {
+			if !strings.Contains(msg, s) {
+				t.Errorf("email does not contain %q:\n%s", s, msg)
+			}
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package retry
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"net"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/AdityaNarayan29/masstDB/internal/database"
+	"github.com/AdityaNarayan29/masstDB/internal/logger"
+	"github.com/AdityaNarayan29/masstDB/internal/storage"
+	"github.com/AdityaNarayan29/masstDB/internal/tunnel"
+)
+
+// Phases of a backup that can be retried
+const (
+	PhaseConnect = "connect"
+	PhaseDump    = "dump"
+	PhaseUpload  = "upload"
+)
+
+// Policy controls how often and how quickly an operation is retried
+type Policy struct {
+	MaxAttempts  int           // Total attempts, including the first (1 disables retries)
+	InitialDelay time.Duration // Delay before the first retry
+	MaxDelay     time.Duration // Upper bound for the backoff delay
+	Multiplier   float64       // Growth factor of the delay between retries
+	Jitter       float64       // Fraction of the delay that is randomized (0-1)
+}
+
+// DefaultPolicy retries transient failures twice, backing off from 5s
+var DefaultPolicy = Policy{
+	MaxAttempts:  3,
+	InitialDelay: 5 * time.Second,
+	MaxDelay:     time.Minute,
+	Multiplier:   2,
+	Jitter:       0.2,
+}
+
+// Attempt records one attempt of a phase
+type Attempt struct {
+	Phase    string    `json:"phase"`
+	Number   int       `json:"attempt"`
+	Time     time.Time `json:"time"`
+	Duration string    `json:"duration"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Delay returns the backoff delay before the given retry (1 for the first
+// retry), with jitter applied
+func (p Policy) Delay(retry int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+
+	delay := float64(p.InitialDelay) * math.Pow(multiplier, float64(retry-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		delay *= 1 - jitter + 2*jitter*rand.Float64()
+	}
+
+	return time.Duration(delay)
+}
+
+// Do runs fn until it succeeds, fails with an error that is not transient,
+// or the policy's attempts are exhausted. Every attempt is logged and
+// returned, along with the error of the last attempt.
+func Do(log *logger.Logger, phase string, policy Policy, fn func() error) ([]Attempt, error) {
+	maxAttempts := policy.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	var attempts []Attempt
+	for number := 1; ; number++ {
+		start := time.Now()
+		err := fn()
+
+		attempt := Attempt{
+			Phase:    phase,
+			Number:   number,
+			Time:     start.UTC(),
+			Duration: time.Since(start).Round(time.Millisecond).String(),
+		}
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+		attempts = append(attempts, attempt)
+
+		if err == nil {
+			if number > 1 {
+				log.With("phase", phase, "attempt", number).Info("%s succeeded after %d attempts", phase, number)
+			}
+			return attempts, nil
+		}
+
+		if number >= maxAttempts || !IsTransient(err) {
+			return attempts, err
+		}
+
+		delay := policy.Delay(number)
+		log.With("phase", phase, "attempt", number).Warn("%s attempt %d/%d failed: %v; retrying in %s",
+			phase, number, maxAttempts, err, delay.Round(time.Millisecond))
+		time.Sleep(delay)
+	}
+}
+
+// transientMessages match stderr lines in which the native tools report
+// failures worth retrying: dropped connections, servers that are starting,
+// shutting down or overloaded, and 5xx responses of the storage services.
+// Patterns are anchored to each tool's own message format so that database
+// or object names quoted in unrelated errors don't trigger retries.
+var transientMessages = []struct {
+	tools   []string
+	pattern *regexp.Regexp
+}{
+	{
+		[]string{"pg_dump", "pg_dumpall", "pg_restore", "psql"},
+		regexp.MustCompile(`^\w+: error: .*(server closed the connection unexpectedly|could not receive data from server|the database system is (starting up|shutting down|in recovery mode)|sorry, too many clients already|remaining connection slots are reserved|terminating connection due to administrator command)`),
+	},
+	{
+		[]string{"mysqldump", "mysql", "mariadb-dump", "mariadb"},
+		regexp.MustCompile(`^(\w[\w-]*: |ERROR \d+ \(\w+\)( at line \d+)?: ).*(Lost connection to (MySQL |MariaDB )?server|(MySQL |MariaDB )?server has gone away|Too many connections|Lock wait timeout exceeded|Deadlock found when trying to get lock)`),
+	},
+	{
+		[]string{"mongodump", "mongorestore", "mongosh"},
+		regexp.MustCompile(`^\S+\s+Failed: .*(connection reset by peer|i/o timeout|incomplete read of message header|PrimarySteppedDown|NotWritablePrimary|InterruptedDueToReplStateChange)`),
+	},
+	{
+		[]string{"aws"},
+		regexp.MustCompile(`^(\w+ failed: .* )?(An error occurred \((InternalError|ServiceUnavailable|SlowDown|RequestTimeout|500|502|503|504)\)|(Read|Connect) timeout on endpoint URL|Could not connect to the endpoint URL|Connection was closed before we received a valid response)`),
+	},
+	{
+		[]string{"gcloud"},
+		regexp.MustCompile(`^ERROR: \(gcloud\.[\w.]+\) (HTTPError (429|5\d\d)|\w+Exception: (429|5\d\d))\b`),
+	},
+}
+
+// IsTransient reports whether err is likely to go away on retry
+func IsTransient(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// Retrying won't fix configuration or environment problems
+	for _, permanent := range []error{
+		database.ErrToolNotFound,
+		database.ErrAuthFailed,
+		database.ErrHostNotFound,
+		database.ErrDatabaseMissing,
+		database.ErrDiskFull,
+		syscall.ENOSPC,
+	} {
+		if errors.Is(err, permanent) {
+			return false
+		}
+	}
+
+	if errors.Is(err, database.ErrHostUnreachable) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	// The SSH connection of a remote tool or an SFTP transfer dropped
+	if tunnel.Disconnected(err) {
+		return true
+	}
+
+	var toolErr *database.ToolError
+	if errors.As(err, &toolErr) {
+		return transientMessage(toolErr.Tool, toolErr.Stderr)
+	}
+
+	var cmdErr *storage.CommandError
+	if errors.As(err, &cmdErr) {
+		return transientMessage(cmdErr.Tool, strings.Split(cmdErr.Stderr, "\n"))
+	}
+
+	return false
+}
+
+// transientMessage reports whether one of the stderr lines of tool reports
+// a transient failure
+func transientMessage(tool string, stderr []string) bool {
+	for _, tm := range transientMessages {
+		if !slices.Contains(tm.tools, tool) {
+			continue
+		}
+		for _, line := range stderr {
+			if tm.pattern.MatchString(strings.TrimSpace(line)) {
+				return true
+			}
+		}
+	}
+	return false
+}
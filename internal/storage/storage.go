@@ -0,0 +1,574 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/AdityaNarayan29/masstDB/internal/tunnel"
+	"github.com/pkg/sftp"
+)
+
+// Location describes where a backup artifact lives
+type Location struct {
+	Scheme string // "" for local files, otherwise s3, gs or sftp
+	Host   string // bucket name or SSH host
+	Port   string
+	User   string
+	Path   string // object key or remote/local file path
+}
+
+// ErrUploadFailed is returned when writing to storage fails
+var ErrUploadFailed = errors.New("storage upload failed")
+
+// Stdio is the location that refers to stdin/stdout
+const Stdio = "-"
+
+// partialSuffix marks an SFTP upload that is still being written
+const partialSuffix = ".partial"
+
+// CommandError is returned when a storage CLI (aws, gcloud) fails
+type CommandError struct {
+	Tool   string
+	Err    error  // Error from running the command
+	Stderr string // Output of the command on stderr
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("%s failed: %s - %s", e.Tool, e.Err, e.Stderr)
+}
+
+func (e *CommandError) Unwrap() error {
+	return e.Err
+}
+
+// Parse parses a local path or a remote URL (s3://, gs://, sftp://)
+func Parse(location string) (Location, error) {
+	if !IsRemote(location) {
+		return Location{Path: location}, nil
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return Location{}, fmt.Errorf("invalid storage URL %q: %w", location, err)
+	}
+
+	loc := Location{
+		Scheme: u.Scheme,
+		Host:   u.Hostname(),
+		Port:   u.Port(),
+		Path:   u.Path,
+	}
+	if u.User != nil {
+		loc.User = u.User.Username()
+	}
+
+	if loc.Host == "" {
+		return Location{}, fmt.Errorf("storage URL %q is missing a bucket or host", location)
+	}
+
+	// Object keys are relative to the bucket
+	if loc.Scheme == "s3" || loc.Scheme == "gs" {
+		loc.Path = strings.TrimPrefix(loc.Path, "/")
+	}
+
+	if loc.Path == "" {
+		return Location{}, fmt.Errorf("storage URL %q is missing an object path", location)
+	}
+
+	return loc, nil
+}
+
+// IsRemote returns true if the location refers to remote storage
+func IsRemote(location string) bool {
+	for _, scheme := range []string{"s3://", "gs://", "sftp://"} {
+		if strings.HasPrefix(location, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the location in URL form (or the plain path for local files)
+func (l Location) String() string {
+	if l.Scheme == "" {
+		return l.Path
+	}
+	host := l.Host
+	if l.User != "" {
+		host = l.User + "@" + host
+	}
+	if l.Port != "" {
+		host += ":" + l.Port
+	}
+	return fmt.Sprintf("%s://%s/%s", l.Scheme, host, strings.TrimPrefix(l.Path, "/"))
+}
+
+// Open opens a backup artifact for streaming reads.
+// Remote artifacts are streamed through the provider's native CLI
+// (aws, gcloud) or an SFTP session so nothing is staged on local disk.
+// The location "-" reads from stdin.
+func Open(location string) (io.ReadCloser, error) {
+	if location == Stdio {
+		return io.NopCloser(os.Stdin), nil
+	}
+
+	loc, err := Parse(location)
+	if err != nil {
+		return nil, err
+	}
+
+	switch loc.Scheme {
+	case "":
+		file, err := os.Open(loc.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open backup file: %w", err)
+		}
+		return file, nil
+	case "s3":
+		return openCommand("aws", "s3", "cp", loc.String(), "-")
+	case "gs":
+		return openCommand("gcloud", "storage", "cat", loc.String())
+	case "sftp":
+		session, err := openSFTP(loc)
+		if err != nil {
+			return nil, err
+		}
+		file, err := session.Open(loc.Path)
+		if err != nil {
+			session.Close()
+			return nil, fmt.Errorf("failed to open %s: %w", loc, err)
+		}
+		return &sftpReader{File: file, session: session}, nil
+	default:
+		return nil, fmt.Errorf("unsupported storage scheme: %s", loc.Scheme)
+	}
+}
+
+// commandReader streams the stdout of a running command
+type commandReader struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	name   string
+	stderr *strings.Builder
+}
+
+// openCommand starts a command and returns a reader over its stdout
+func openCommand(name string, args ...string) (io.ReadCloser, error) {
+	cmd := exec.Command(name, args...)
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s pipe: %w", name, err)
+	}
+
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start %s: %w", name, err)
+	}
+
+	return &commandReader{ReadCloser: stdout, cmd: cmd, name: name, stderr: &stderr}, nil
+}
+
+// Read reads from the command's stdout, surfacing the command's
+// error instead of a bare EOF if it exited unsuccessfully
+func (c *commandReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if err == io.EOF {
+		if waitErr := c.wait(); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+// Close stops the command if it is still running
+func (c *commandReader) Close() error {
+	if c.cmd.ProcessState == nil {
+		c.cmd.Process.Kill()
+		c.cmd.Wait()
+	}
+	return nil
+}
+
+func (c *commandReader) wait() error {
+	if c.cmd.ProcessState != nil {
+		if !c.cmd.ProcessState.Success() {
+			return &CommandError{Tool: c.name, Err: &exec.ExitError{ProcessState: c.cmd.ProcessState}, Stderr: strings.TrimSpace(c.stderr.String())}
+		}
+		return nil
+	}
+	if err := c.cmd.Wait(); err != nil {
+		return &CommandError{Tool: c.name, Err: err, Stderr: strings.TrimSpace(c.stderr.String())}
+	}
+	return nil
+}
+
+// ReadFile reads a small object (such as a lock file) from storage.
+// Returns an error wrapping os.ErrNotExist if the object doesn't exist.
+func ReadFile(location string) ([]byte, error) {
+	loc, err := Parse(location)
+	if err != nil {
+		return nil, err
+	}
+
+	switch loc.Scheme {
+	case "":
+		return os.ReadFile(loc.Path)
+	case "s3":
+		return runCommand(nil, "aws", "s3", "cp", loc.String(), "-")
+	case "gs":
+		return runCommand(nil, "gcloud", "storage", "cat", loc.String())
+	case "sftp":
+		session, err := openSFTP(loc)
+		if err != nil {
+			return nil, err
+		}
+		defer session.Close()
+		file, err := session.Open(loc.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", loc, err)
+		}
+		defer file.Close()
+		return io.ReadAll(file)
+	default:
+		return nil, fmt.Errorf("unsupported storage scheme: %s", loc.Scheme)
+	}
+}
+
+// WriteFile writes a small object to storage, replacing any existing one
+func WriteFile(location string, data []byte) error {
+	loc, err := Parse(location)
+	if err != nil {
+		return err
+	}
+
+	switch loc.Scheme {
+	case "":
+		err = os.WriteFile(loc.Path, data, 0644)
+	case "s3":
+		_, err = runCommand(bytes.NewReader(data), "aws", "s3", "cp", "-", loc.String())
+	case "gs":
+		_, err = runCommand(bytes.NewReader(data), "gcloud", "storage", "cp", "-", loc.String())
+	case "sftp":
+		err = uploadSFTP(loc, bytes.NewReader(data))
+	default:
+		return fmt.Errorf("unsupported storage scheme: %s", loc.Scheme)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUploadFailed, err)
+	}
+	return nil
+}
+
+// Upload copies a local file to storage, streaming it through the
+// provider's native CLI or an SFTP session
+func Upload(path, location string) error {
+	loc, err := Parse(location)
+	if err != nil {
+		return err
+	}
+
+	switch loc.Scheme {
+	case "s3":
+		_, err = runCommand(nil, "aws", "s3", "cp", "--only-show-errors", path, loc.String())
+	case "gs":
+		_, err = runCommand(nil, "gcloud", "storage", "cp", path, loc.String())
+	case "sftp":
+		var file *os.File
+		file, err = os.Open(path)
+		if err != nil {
+			return fmt.Errorf("failed to open %s for upload: %w", path, err)
+		}
+		defer file.Close()
+		err = uploadSFTP(loc, file)
+	default:
+		return fmt.Errorf("uploads need a remote location, got %q", location)
+	}
+
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrUploadFailed, err)
+	}
+	return nil
+}
+
+// Remove deletes an object from storage. Removing a missing object is not an error.
+func Remove(location string) error {
+	loc, err := Parse(location)
+	if err != nil {
+		return err
+	}
+
+	switch loc.Scheme {
+	case "":
+		err = os.Remove(loc.Path)
+	case "s3":
+		_, err = runCommand(nil, "aws", "s3", "rm", loc.String())
+	case "gs":
+		_, err = runCommand(nil, "gcloud", "storage", "rm", loc.String())
+	case "sftp":
+		var session *sftpSession
+		session, err = openSFTP(loc)
+		if err != nil {
+			return err
+		}
+		defer session.Close()
+		err = session.Remove(loc.Path)
+	default:
+		err = fmt.Errorf("unsupported storage scheme: %s", loc.Scheme)
+	}
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// List returns the names of the objects directly under a storage prefix
+func List(location string) ([]string, error) {
+	loc, err := Parse(location)
+	if err != nil {
+		return nil, err
+	}
+
+	var output []byte
+	switch loc.Scheme {
+	case "":
+		entries, err := os.ReadDir(loc.Path)
+		if err != nil {
+			return nil, err
+		}
+		var names []string
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				names = append(names, entry.Name())
+			}
+		}
+		return names, nil
+	case "s3":
+		output, err = runCommand(nil, "aws", "s3", "ls", strings.TrimSuffix(loc.String(), "/")+"/")
+	case "gs":
+		output, err = runCommand(nil, "gcloud", "storage", "ls", strings.TrimSuffix(loc.String(), "/")+"/")
+	case "sftp":
+		return listSFTP(loc)
+	default:
+		return nil, fmt.Errorf("unsupported storage scheme: %s", loc.Scheme)
+	}
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasSuffix(line, "/") {
+			continue
+		}
+		// aws prints "date time size name", gcloud prints full URLs
+		name := fields[len(fields)-1]
+		names = append(names, name[strings.LastIndex(name, "/")+1:])
+	}
+	return names, nil
+}
+
+// sftpSession is an SFTP session with the SSH server of an sftp location
+type sftpSession struct {
+	*sftp.Client
+	conn *tunnel.Client
+}
+
+// openSFTP connects to the SSH server of an sftp location, authenticating
+// like the SSH tunnel: with the ssh-agent, or the default key when no
+// agent is running, and host keys from ~/.ssh/known_hosts
+func openSFTP(loc Location) (*sftpSession, error) {
+	config := tunnel.Config{Host: loc.Host, User: loc.User, KeyFile: defaultKeyFile()}
+	if loc.Port != "" {
+		port, err := strconv.Atoi(loc.Port)
+		if err != nil {
+			return nil, fmt.Errorf("invalid SFTP port %q", loc.Port)
+		}
+		config.Port = port
+	}
+
+	conn, err := tunnel.Connect(config)
+	if err != nil {
+		return nil, err
+	}
+	client, err := conn.SFTP()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to start SFTP session on %s: %w", config.Address(), err)
+	}
+	return &sftpSession{Client: client, conn: conn}, nil
+}
+
+// Close ends the SFTP session and disconnects from the server
+func (s *sftpSession) Close() error {
+	s.Client.Close()
+	return s.conn.Close()
+}
+
+// defaultKeyFile returns the first of the default SSH keys that exists
+// when no ssh-agent is running, and "" to use the agent
+func defaultKeyFile() string {
+	if os.Getenv("SSH_AUTH_SOCK") != "" {
+		return ""
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	for _, name := range []string{"id_ed25519", "id_ecdsa", "id_rsa"} {
+		path := filepath.Join(home, ".ssh", name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// sftpReader streams a remote file, ending the session when closed
+type sftpReader struct {
+	*sftp.File
+	session *sftpSession
+}
+
+func (r *sftpReader) Close() error {
+	r.File.Close()
+	return r.session.Close()
+}
+
+// uploadSFTP writes r to a temporary file next to the location and renames
+// it into place, so readers never see a partial object. Missing
+// directories are created.
+func uploadSFTP(loc Location, r io.Reader) error {
+	session, err := openSFTP(loc)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	// Directories are created on demand, like bucket prefixes
+	if err := session.MkdirAll(path.Dir(loc.Path)); err != nil {
+		return fmt.Errorf("failed to create %s: %w", path.Dir(loc.Path), err)
+	}
+
+	partial := loc.Path + partialSuffix
+	file, err := session.Create(partial)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", partial, err)
+	}
+	if _, err := file.ReadFrom(r); err != nil {
+		file.Close()
+		session.Remove(partial)
+		return fmt.Errorf("failed to write %s: %w", partial, err)
+	}
+	if err := file.Close(); err != nil {
+		session.Remove(partial)
+		return fmt.Errorf("failed to write %s: %w", partial, err)
+	}
+
+	if err := session.PosixRename(partial, loc.Path); err != nil {
+		session.Remove(partial)
+		return fmt.Errorf("failed to rename %s: %w", partial, err)
+	}
+	return nil
+}
+
+// listSFTP returns the names of the files in a remote directory
+func listSFTP(loc Location) ([]string, error) {
+	session, err := openSFTP(loc)
+	if err != nil {
+		return nil, err
+	}
+	defer session.Close()
+
+	entries, err := session.ReadDir(loc.Path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if entry.Mode().IsRegular() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// Join appends a name to a storage location
+func Join(location, name string) string {
+	if !IsRemote(location) {
+		return filepath.Join(location, name)
+	}
+	return strings.TrimSuffix(location, "/") + "/" + name
+}
+
+// runCommand runs a storage CLI command to completion, feeding it stdin
+// (if non-nil) and returning its stdout
+func runCommand(stdin io.Reader, name string, args ...string) ([]byte, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = stdin
+
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		if isNotFound(stderr.String()) {
+			return nil, fmt.Errorf("%s: %w", args[len(args)-1], os.ErrNotExist)
+		}
+		return nil, &CommandError{Tool: name, Err: err, Stderr: strings.TrimSpace(stderr.String())}
+	}
+
+	return output, nil
+}
+
+// isNotFound recognizes the "missing object" messages of the storage CLIs
+func isNotFound(stderr string) bool {
+	for _, pattern := range []string{"(404)", "NoSuchKey", "No such file", "matched no objects", "No URLs matched", "not found"} {
+		if strings.Contains(stderr, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// SyncDir fsyncs a directory so that renames within it are durable
+func SyncDir(dir string) error {
+	// Directories can't be opened for syncing on Windows
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open directory %s: %w", dir, err)
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("failed to sync directory %s: %w", dir, err)
+	}
+
+	return nil
+}
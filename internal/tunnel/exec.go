@@ -0,0 +1,73 @@
+package tunnel
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// Client runs commands on an SSH server
+type Client struct {
+	client *ssh.Client
+}
+
+// Connect connects to the SSH server for running commands
+func Connect(config Config) (*Client, error) {
+	client, err := dial(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{client: client}, nil
+}
+
+// Run runs a shell command on the server, connecting its standard streams
+// to stdin, stdout and stderr (any of which may be nil)
+func (c *Client) Run(command string, stdin io.Reader, stdout, stderr io.Writer) error {
+	session, err := c.client.NewSession()
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	session.Stdin = stdin
+	session.Stdout = stdout
+	session.Stderr = stderr
+	return session.Run(command)
+}
+
+// SFTP starts an SFTP session on the connection. The session must be
+// closed before the client.
+func (c *Client) SFTP() (*sftp.Client, error) {
+	return sftp.NewClient(c.client)
+}
+
+// Close disconnects from the SSH server
+func (c *Client) Close() error {
+	return c.client.Close()
+}
+
+// ExitStatus returns the exit status of a command that failed in Run, and
+// false if the command didn't run to completion
+func ExitStatus(err error) (int, bool) {
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitStatus(), true
+	}
+	return 0, false
+}
+
+// Disconnected reports whether a command run in Run or an SFTP session
+// lost its connection to the server before it completed
+func Disconnected(err error) bool {
+	var missingErr *ssh.ExitMissingError
+	return errors.As(err, &missingErr) || errors.Is(err, sftp.ErrSSHFxConnectionLost)
+}
+
+// Quote quotes s as a single word of the POSIX shell command lines run by
+// SSH servers
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,212 @@
+package tunnel
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// DefaultPort is the SSH port used when none is configured
+const DefaultPort = 22
+
+// dialTimeout bounds connecting to the SSH server
+const dialTimeout = 30 * time.Second
+
+// Config describes an SSH tunnel through a bastion host
+type Config struct {
+	Host       string
+	Port       int    // Default 22
+	User       string // Default: the current user
+	KeyFile    string // Private key; the ssh-agent is used if empty
+	KnownHosts string // Default ~/.ssh/known_hosts
+}
+
+// Tunnel forwards a local port to a remote address through an SSH server
+type Tunnel struct {
+	client   *ssh.Client
+	listener net.Listener
+	remote   string
+	wg       sync.WaitGroup
+}
+
+// Open connects to the SSH server and forwards a local port on 127.0.0.1
+// to the remote address, as seen from the SSH server
+func Open(config Config, remote string) (*Tunnel, error) {
+	client, err := dial(config)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to listen for SSH tunnel: %w", err)
+	}
+
+	t := &Tunnel{client: client, listener: listener, remote: remote}
+	go t.serve()
+
+	return t, nil
+}
+
+// dial connects and authenticates to the SSH server
+func dial(config Config) (*ssh.Client, error) {
+	clientConfig, agentConn, err := config.clientConfig()
+	if err != nil {
+		return nil, err
+	}
+	// The ssh-agent is only needed to authenticate
+	if agentConn != nil {
+		defer agentConn.Close()
+	}
+
+	client, err := ssh.Dial("tcp", config.Address(), clientConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SSH server %s: %w", config.Address(), err)
+	}
+	return client, nil
+}
+
+// Port returns the local port forwarded to the remote address
+func (t *Tunnel) Port() int {
+	return t.listener.Addr().(*net.TCPAddr).Port
+}
+
+// Close stops forwarding and disconnects from the SSH server
+func (t *Tunnel) Close() error {
+	err := t.listener.Close()
+	t.client.Close()
+	t.wg.Wait()
+	return err
+}
+
+// serve accepts local connections until the listener is closed
+func (t *Tunnel) serve() {
+	for {
+		local, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		t.wg.Add(1)
+		go t.forward(local)
+	}
+}
+
+// forward copies data between a local connection and the remote address
+func (t *Tunnel) forward(local net.Conn) {
+	defer t.wg.Done()
+	defer local.Close()
+
+	remote, err := t.client.Dial("tcp", t.remote)
+	if err != nil {
+		return
+	}
+	defer remote.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+
+	// Either side closing ends the connection
+	<-done
+}
+
+// Address returns the host:port of the SSH server
+func (c Config) Address() string {
+	port := c.Port
+	if port == 0 {
+		port = DefaultPort
+	}
+	return net.JoinHostPort(c.Host, strconv.Itoa(port))
+}
+
+// clientConfig builds the SSH client configuration: key file or
+// ssh-agent authentication and known_hosts host key verification. The
+// ssh-agent connection, if any, must be closed by the caller.
+func (c Config) clientConfig() (*ssh.ClientConfig, io.Closer, error) {
+	if c.Host == "" {
+		return nil, nil, errors.New("SSH tunnel host is required")
+	}
+
+	username := c.User
+	if username == "" {
+		current, err := user.Current()
+		if err != nil {
+			return nil, nil, fmt.Errorf("SSH tunnel user is required: %w", err)
+		}
+		username = current.Username
+	}
+
+	knownHostsFile := c.KnownHosts
+	if knownHostsFile == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, nil, fmt.Errorf("known_hosts file is required: %w", err)
+		}
+		knownHostsFile = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	hostKeyCallback, err := knownhosts.New(knownHostsFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load known_hosts: %w", err)
+	}
+
+	auth, agentConn, err := c.authMethod()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &ssh.ClientConfig{
+		User:            username,
+		Auth:            []ssh.AuthMethod{auth},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         dialTimeout,
+	}, agentConn, nil
+}
+
+// authMethod authenticates with the key file, or the ssh-agent if no key
+// file is configured. Returns the ssh-agent connection too, nil for key
+// files.
+func (c Config) authMethod() (ssh.AuthMethod, io.Closer, error) {
+	if c.KeyFile != "" {
+		key, err := os.ReadFile(c.KeyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read SSH key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			var missing *ssh.PassphraseMissingError
+			if errors.As(err, &missing) {
+				return nil, nil, fmt.Errorf("SSH key %s is encrypted; load it into ssh-agent instead", c.KeyFile)
+			}
+			return nil, nil, fmt.Errorf("failed to parse SSH key: %w", err)
+		}
+		return ssh.PublicKeys(signer), nil, nil
+	}
+
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, nil, errors.New("SSH tunnel needs a key file or a running ssh-agent")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to ssh-agent: %w", err)
+	}
+	return ssh.PublicKeysCallback(agent.NewClient(conn).Signers), conn, nil
+}
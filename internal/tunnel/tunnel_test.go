@@ -0,0 +1,415 @@
+package tunnel
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// testServer is an in-process SSH server accepting one client key. It
+// forwards direct-tcpip channels, answers exec requests with the command,
+// exiting with status 3 for "fail", and serves the SFTP subsystem.
+type testServer struct {
+	addr       string
+	hostKey    ssh.Signer
+	knownHosts string
+}
+
+// newKey generates an ed25519 signer
+func newKey(t *testing.T) (ssh.Signer, ed25519.PrivateKey) {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatalf("signer: %v", err)
+	}
+	return signer, private
+}
+
+// startServer starts an SSH server on a local listener authorizing the
+// client key
+func startServer(t *testing.T, clientKey ssh.PublicKey) *testServer {
+	t.Helper()
+	hostKey, _ := newKey(t)
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), clientKey.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown key for %s", conn.User())
+		},
+	}
+	config.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveConn(conn, config)
+		}
+	}()
+
+	s := &testServer{addr: listener.Addr().String(), hostKey: hostKey}
+	s.knownHosts = filepath.Join(t.TempDir(), "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(s.addr)}, hostKey.PublicKey())
+	if err := os.WriteFile(s.knownHosts, []byte(line+"\n"), 0600); err != nil {
+		t.Fatalf("write known_hosts: %v", err)
+	}
+	return s
+}
+
+// config returns a client configuration for the server
+func (s *testServer) config(t *testing.T, keyFile string) Config {
+	t.Helper()
+	host, port, _ := net.SplitHostPort(s.addr)
+	portNumber, _ := strconv.Atoi(port)
+	return Config{Host: host, Port: portNumber, User: "backup", KeyFile: keyFile, KnownHosts: s.knownHosts}
+}
+
+func serveConn(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+
+	for newChannel := range channels {
+		switch newChannel.ChannelType() {
+		case "direct-tcpip":
+			go serveForward(newChannel)
+		case "session":
+			go serveSession(newChannel)
+		default:
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+}
+
+// serveForward connects a direct-tcpip channel to its destination
+func serveForward(newChannel ssh.NewChannel) {
+	var target struct {
+		Host       string
+		Port       uint32
+		OriginHost string
+		OriginPort uint32
+	}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, "invalid forward")
+		return
+	}
+
+	remote, err := net.Dial("tcp", net.JoinHostPort(target.Host, strconv.Itoa(int(target.Port))))
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	defer remote.Close()
+
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+	go ssh.DiscardRequests(requests)
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, channel)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(channel, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// serveSession answers an exec request with the command it was given, or
+// serves SFTP
+func serveSession(newChannel ssh.NewChannel) {
+	channel, requests, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer channel.Close()
+
+	for request := range requests {
+		if request.Type == "subsystem" && string(request.Payload[4:]) == "sftp" {
+			request.Reply(true, nil)
+			go ssh.DiscardRequests(requests)
+			server, err := sftp.NewServer(channel)
+			if err != nil {
+				return
+			}
+			server.Serve()
+			return
+		}
+		if request.Type != "exec" {
+			request.Reply(false, nil)
+			continue
+		}
+		var exec struct{ Command string }
+		ssh.Unmarshal(request.Payload, &exec)
+		request.Reply(true, nil)
+
+		input, _ := io.ReadAll(channel)
+		fmt.Fprintf(channel, "ran %s with %q", exec.Command, input)
+
+		status := uint32(0)
+		if exec.Command == "fail" {
+			fmt.Fprint(channel.Stderr(), "failed")
+			status = 3
+		}
+		channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+		return
+	}
+}
+
+// writeKeyFile writes an unencrypted OpenSSH private key
+func writeKeyFile(t *testing.T, private ed25519.PrivateKey) string {
+	t.Helper()
+	block, err := ssh.MarshalPrivateKey(private, "")
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	return path
+}
+
+// startEcho starts a TCP server echoing its input back
+func startEcho(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestTunnelForwards(t *testing.T) {
+	signer, private := newKey(t)
+	server := startServer(t, signer.PublicKey())
+	echo := startEcho(t)
+
+	tun, err := Open(server.config(t, writeKeyFile(t, private)), echo)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer tun.Close()
+
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(tun.Port())))
+	if err != nil {
+		t.Fatalf("dial tunnel: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := io.WriteString(conn, "ping"); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	reply := make([]byte, 4)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if string(reply) != "ping" {
+		t.Errorf("got %q through the tunnel, want %q", reply, "ping")
+	}
+}
+
+func TestClientRun(t *testing.T) {
+	signer, private := newKey(t)
+	server := startServer(t, signer.PublicKey())
+
+	client, err := Connect(server.config(t, writeKeyFile(t, private)))
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer client.Close()
+
+	var stdout strings.Builder
+	if err := client.Run("pg_dump app", strings.NewReader("input"), &stdout, nil); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if want := `ran pg_dump app with "input"`; stdout.String() != want {
+		t.Errorf("stdout = %q, want %q", stdout.String(), want)
+	}
+
+	var stderr strings.Builder
+	err = client.Run("fail", nil, io.Discard, &stderr)
+	if status, ok := ExitStatus(err); !ok || status != 3 {
+		t.Errorf("ExitStatus(%v) = %d, %v; want 3", err, status, ok)
+	}
+	if stderr.String() != "failed" {
+		t.Errorf("stderr = %q, want %q", stderr.String(), "failed")
+	}
+}
+
+func TestClientSFTP(t *testing.T) {
+	signer, private := newKey(t)
+	server := startServer(t, signer.PublicKey())
+
+	client, err := Connect(server.config(t, writeKeyFile(t, private)))
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer client.Close()
+
+	session, err := client.SFTP()
+	if err != nil {
+		t.Fatalf("SFTP: %v", err)
+	}
+	defer session.Close()
+
+	path := filepath.Join(t.TempDir(), "backup.sql.gz")
+	file, err := session.Create(path)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := file.Write([]byte("dump")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	file.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "dump" {
+		t.Errorf("remote file = %q, %v; want %q", data, err, "dump")
+	}
+}
+
+func TestUnknownHostKey(t *testing.T) {
+	signer, private := newKey(t)
+	server := startServer(t, signer.PublicKey())
+
+	config := server.config(t, writeKeyFile(t, private))
+	config.KnownHosts = filepath.Join(t.TempDir(), "empty_known_hosts")
+	if err := os.WriteFile(config.KnownHosts, nil, 0600); err != nil {
+		t.Fatalf("write known_hosts: %v", err)
+	}
+
+	if _, err := Connect(config); err == nil || !strings.Contains(err.Error(), "key is unknown") {
+		t.Errorf("Connect = %v, want an unknown host key error", err)
+	}
+}
+
+func TestWrongKey(t *testing.T) {
+	signer, _ := newKey(t)
+	server := startServer(t, signer.PublicKey())
+	_, other := newKey(t)
+
+	if _, err := Connect(server.config(t, writeKeyFile(t, other))); err == nil || !strings.Contains(err.Error(), "unable to authenticate") {
+		t.Errorf("Connect = %v, want an authentication error", err)
+	}
+}
+
+func TestAgentConnectionClosed(t *testing.T) {
+	signer, private := newKey(t)
+	server := startServer(t, signer.PublicKey())
+
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: private}); err != nil {
+		t.Fatalf("add key: %v", err)
+	}
+
+	// Unix socket paths are limited in length, so avoid long temp dirs
+	dir, err := os.MkdirTemp("", "agent")
+	if err != nil {
+		t.Fatalf("temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	socket := filepath.Join(dir, "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	t.Setenv("SSH_AUTH_SOCK", socket)
+
+	var mu sync.Mutex
+	open := 0
+	closed := make(chan struct{}, 10)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			open++
+			mu.Unlock()
+			go func() {
+				agent.ServeAgent(keyring, conn)
+				conn.Close()
+				mu.Lock()
+				open--
+				mu.Unlock()
+				closed <- struct{}{}
+			}()
+		}
+	}()
+
+	for i := 0; i < 3; i++ {
+		tun, err := Open(server.config(t, ""), startEcho(t))
+		if err != nil {
+			t.Fatalf("Open: %v", err)
+		}
+		tun.Close()
+
+		select {
+		case <-closed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("ssh-agent connection was not closed")
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if open != 0 {
+		t.Errorf("%d ssh-agent connections left open", open)
+	}
+}